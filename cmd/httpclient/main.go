@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/headers"
+)
+
+type headerList []string
+
+func (h *headerList) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerList) Set(val string) error {
+	if !strings.Contains(val, ":") {
+		return fmt.Errorf("header %q must have the form \"Name: value\"", val)
+	}
+	*h = append(*h, val)
+	return nil
+}
+
+func main() {
+	var hdrs headerList
+	method := flag.String("X", "", "request method (GET, or POST when a body is given)")
+	flag.Var(&hdrs, "H", "request header as \"Name: value\", may be repeated")
+	data := flag.String("d", "", "request body; @file reads it from a file and @- from stdin")
+	verbose := flag.Bool("v", false, "print the raw request and response bytes to stderr")
+	include := flag.Bool("i", false, "include the response status line and headers in the output")
+	follow := flag.Bool("L", false, "follow redirects, keeping cookies set along the way")
+	maxRedirs := flag.Int("max-redirs", 10, "maximum number of redirects followed with -L")
+	timeout := flag.Duration("timeout", 0, "time limit for the whole request, 0 for none")
+	insecure := flag.Bool("k", false, "skip TLS certificate verification")
+	fail := flag.Bool("f", false, "exit with status 22 when the response status is 400 or above")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] url\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("httpclient: ")
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rawURL := flag.Arg(0)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	body, err := readBody(*data)
+	if err != nil {
+		log.Fatalf("couldn't read request body: %s", err.Error())
+	}
+	if *method == "" && body != nil {
+		*method = "POST"
+	}
+
+	req, err := client.NewRequest(strings.ToUpper(*method), rawURL, body)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	for _, h := range hdrs {
+		name, val, _ := strings.Cut(h, ":")
+		name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+		if prev, ok := req.Headers.Get(name); ok {
+			req.Headers.Set(name, prev, val)
+		} else {
+			req.Headers.Set(name, val)
+		}
+	}
+
+	c := &client.Client{
+		Timeout:         *timeout,
+		FollowRedirects: *follow,
+		MaxRedirects:    *maxRedirs,
+	}
+	if *follow {
+		c.Jar = client.NewJar()
+	}
+	if *insecure {
+		c.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	var traces []*traceConn
+	if *verbose {
+		c.WrapConn = func(conn net.Conn) net.Conn {
+			fmt.Fprintf(os.Stderr, "* Connected to %s\n", conn.RemoteAddr())
+			tc := &traceConn{
+				Conn:     conn,
+				sent:     &tracer{out: os.Stderr, prefix: "> "},
+				received: &tracer{out: os.Stderr, prefix: "< "},
+			}
+			traces = append(traces, tc)
+			return tc
+		}
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		log.Fatalf("request failed: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	out := os.Stdout
+	if *include {
+		writeHead(out, res)
+	}
+	if _, err := io.Copy(out, res.Body); err != nil {
+		log.Fatalf("couldn't read response body: %s", err.Error())
+	}
+	for _, tc := range traces {
+		tc.received.endLine()
+	}
+	if *include && len(res.Trailers) > 0 {
+		fmt.Fprintln(out)
+		writeFields(out, res.Trailers, nil)
+	}
+
+	if *fail && res.StatusCode >= 400 {
+		os.Exit(22)
+	}
+}
+
+func readBody(data string) ([]byte, error) {
+	switch {
+	case data == "":
+		return nil, nil
+	case data == "@-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+func writeHead(w io.Writer, res *client.Response) {
+	fmt.Fprintf(w, "%s %d %s\r\n", res.Proto, res.StatusCode, res.Reason)
+	writeFields(w, res.Headers, res.SetCookies)
+	fmt.Fprint(w, "\r\n")
+}
+
+func writeFields(w io.Writer, fields headers.Headers, setCookies []string) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if strings.EqualFold(key, "Set-Cookie") {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s: %s\r\n", key, fields[key])
+	}
+	for _, line := range setCookies {
+		fmt.Fprintf(w, "Set-Cookie: %s\r\n", line)
+	}
+}
+
+type traceConn struct {
+	net.Conn
+	sent, received *tracer
+}
+
+func (c *traceConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.write(p[:n])
+	return n, err
+}
+
+func (c *traceConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.sent.write(p[:n])
+	return n, err
+}
+
+// tracer prints bytes line by line behind a direction prefix, the way curl's
+// verbose mode does.
+type tracer struct {
+	out     io.Writer
+	prefix  string
+	midLine bool
+}
+
+func (t *tracer) write(p []byte) {
+	for len(p) > 0 {
+		if !t.midLine {
+			io.WriteString(t.out, t.prefix)
+		}
+		line, rest, found := bytes.Cut(p, []byte("\n"))
+		t.out.Write(bytes.TrimSuffix(line, []byte("\r")))
+		if found {
+			io.WriteString(t.out, "\n")
+		}
+		t.midLine = !found
+		p = rest
+	}
+}
+
+func (t *tracer) endLine() {
+	if t.midLine {
+		io.WriteString(t.out, "\n")
+		t.midLine = false
+	}
+}
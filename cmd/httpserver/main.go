@@ -1,29 +1,84 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/capture"
+	"github.com/alerone/httpfromtcp/internal/compression"
+	"github.com/alerone/httpfromtcp/internal/fileserver"
+	"github.com/alerone/httpfromtcp/internal/negotiation"
+	"github.com/alerone/httpfromtcp/internal/proxy"
 	"github.com/alerone/httpfromtcp/internal/request"
 	"github.com/alerone/httpfromtcp/internal/response"
 	"github.com/alerone/httpfromtcp/internal/server"
+	"github.com/alerone/httpfromtcp/internal/sse"
+	"github.com/alerone/httpfromtcp/internal/websocket"
 )
 
-const port = 42069
+const (
+	port        = 42069
+	maxBodySize = 10 << 20
+)
 
 func main() {
-	server, err := server.Serve(port, routeServing)
+	connectAllow := flag.String("connect-allow", "", "comma separated host:port patterns to tunnel CONNECT requests to")
+	backends := flag.String("backends", "", "comma separated upstream urls load balanced under /lb")
+	strategy := flag.String("lb-strategy", "roundrobin", "load balancing strategy: roundrobin, leastconn or hash")
+	hashHeader := flag.String("lb-hash-header", "", "request header hashed by the hash strategy (client address if empty)")
+	healthPath := flag.String("lb-health-path", "", "path polled on each backend for active health checks")
+	capturePath := flag.String("capture", "", "append every request/response pair to this JSON Lines file")
+	harPath := flag.String("har", "", "write the captured exchanges to this HAR file on shutdown")
+	flag.Parse()
+
+	if *backends != "" {
+		pool, err := newPool(*backends, *strategy)
+		if err != nil {
+			log.Fatalf("Error creating upstream pool: %s", err)
+		}
+		pool.HashHeader = *hashHeader
+		pool.HealthPath = *healthPath
+		pool.StartHealthChecks()
+		defer pool.Close()
+
+		lb := proxy.NewPoolProxy(pool)
+		lb.StripPrefix = "/lb"
+		routes["/lb"] = lb.Handle
+	}
+
+	var opts []server.Option
+	if *connectAllow != "" {
+		opts = append(opts, server.WithConnectProxy(server.ConnectProxy{
+			Allow:       strings.Split(*connectAllow, ","),
+			IdleTimeout: 5 * time.Minute,
+		}))
+	}
+
+	handler := compression.Compress(compression.Decompress(routeServing, maxBodySize))
+	var rec *capture.Recorder
+	if *capturePath != "" || *harPath != "" {
+		var out io.Writer
+		if *capturePath != "" {
+			f, err := os.OpenFile(*capturePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				log.Fatalf("Error opening capture file: %s", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		rec = capture.NewRecorder(out)
+		handler = capture.Record(rec, handler)
+	}
+
+	server, err := server.Serve(port, handler, opts...)
 	if err != nil {
 		log.Fatalf("Error starting server: %s", err)
 	}
@@ -34,25 +89,66 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+	if *harPath != "" {
+		if err := writeHAR(*harPath, rec.Entries()); err != nil {
+			log.Printf("Error writing HAR file: %s", err)
+		}
+	}
 	log.Println("Server gracefully stopped")
 }
 
 var routes = map[string]server.Handler{
 	"/myproblem":   myProblemRoute,
 	"/yourproblem": yourProblemRoute,
-	"/httpbin":     httpbinRoute,
+	"/httpbin":     httpbinProxy.Handle,
 	"/video":     videoRoute,
+	"/assets":    assetsServer.Handle,
+	"/events":    eventsRoute,
+	"/ws":        websocket.Handle(upgrader, echoSocket),
+}
+
+var upgrader = &websocket.Upgrader{EnableCompression: true}
+
+var assetsServer = &fileserver.FileServer{
+	Root:            "./assets",
+	Prefix:          "/assets",
+	ListDirectories: true,
 }
 
 func routeServing(w *response.Writer, r *request.Request) {
 	for route, handler := range routes {
-		if strings.HasPrefix(r.RequestLine.RequestTarget, route) {
+		if matchesRoute(r.RequestLine.RequestTarget, route) {
 			handler(w, r)
 			return
 		}
 	}
-	w.WriteStatusLine(response.OkStatus)
-	bdy := `<html>
+	successRoute(w, r)
+}
+
+// matchesRoute reports whether target is route or lies below it, so that
+// /ws matches /ws/chat and /ws?v=1 but not /wsfoo.
+func matchesRoute(target, route string) bool {
+	path, _, _ := strings.Cut(target, "?")
+	return path == route || strings.HasPrefix(path, route+"/")
+}
+
+var successOffers = []string{"text/html", "application/json", "text/plain"}
+
+func successRoute(w *response.Writer, r *request.Request) {
+	ctype, ok := negotiation.ContentType(r, successOffers)
+	if !ok {
+		negotiation.NotAcceptable(w, successOffers)
+		return
+	}
+
+	var bdy string
+	switch ctype {
+	case "application/json":
+		bdy = `{"status":200,"message":"Your request was an absolute banger."}`
+	case "text/plain":
+		bdy = "Success! Your request was an absolute banger.\n"
+	default:
+		bdy = `<html>
 			  <head>
 				<title>200 OK</title>
 			  </head>
@@ -62,95 +158,99 @@ func routeServing(w *response.Writer, r *request.Request) {
 			  </body>
 	        </html>
 	`
+	}
+	w.WriteStatusLine(response.OkStatus)
 	hdrs := response.GetDefaultHeaders(len(bdy))
-	hdrs.Set("Content-Type", "text/html")
+	hdrs.Set("Content-Type", ctype)
+	hdrs.Set("Vary", "Accept")
 	w.WriteHeaders(hdrs)
 	w.WriteBody([]byte(bdy))
 }
 
-func httpbinRoute(w *response.Writer, r *request.Request) {
-	path := strings.TrimPrefix(r.RequestLine.RequestTarget, "/httpbin")
-	url := "https://httpbin.org" + path
-	res, err := http.Get(url)
-	if err != nil {
-		w.WriteStatusLine(400)
-		bdy := `<html>
-			  <head>
-				<title>400 Bad request</title>
-			  </head>
-			  <body>
-				<h1>Not found on httpbin.org</h1>
-			  </body>
-	        </html>
-		`
-		hdrs := response.GetDefaultHeaders(len(bdy))
-		hdrs.Set("Content-Type", "text/html")
-		w.WriteHeaders(hdrs)
-		w.WriteBody([]byte(bdy))
-		return
+func newPool(backends, strategy string) (*proxy.Pool, error) {
+	strategies := map[string]proxy.Strategy{
+		"roundrobin": proxy.RoundRobin,
+		"leastconn":  proxy.LeastConnections,
+		"hash":       proxy.ConsistentHash,
 	}
-	buf := make([]byte, 1024)
-	w.WriteStatusLine(response.OkStatus)
-	hdrs := response.GetDefaultHeaders(0)
-	hdrs.Remove("content-length")
-	hdrs.Set("Trailers", "X-Content-SHA256", "X-Content-Length")
-	hdrs.Set("Transfer-Encoding", "chunked")
-	hdrs.Set("Host", "httpbin.org")
-	w.WriteHeaders(hdrs)
-	var readBuf bytes.Buffer
-	for {
-		n, err := res.Body.Read(buf)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				trailers := headers.NewHeaders()
-				sum := sha256.Sum256(readBuf.Bytes())
-				trailers.Set("X-Content-SHA256", fmt.Sprintf("%x", sum))
-				trailers.Set("X-Content-Length", strconv.Itoa(readBuf.Len()))
-				err = w.WriteTrailers(trailers)
-				if err != nil {
-					fmt.Println(err)
-				}
-				return
-			}
-			fmt.Println(err.Error())
-			return
-		}
-		fmt.Println("Read: ", n)
+	s, ok := strategies[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown load balancing strategy: %s", strategy)
+	}
+	return proxy.NewPool(s, strings.Split(backends, ",")...)
+}
 
-		readBuf.Write(buf)
-		_, err = w.WriteChunkedBody(buf)
-		if err != nil {
-			fmt.Println(err)
-		}
+func writeHAR(path string, entries []capture.Entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := capture.WriteHAR(f, entries); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
+}
+
+var httpbinProxy = newHTTPBinProxy()
 
+func newHTTPBinProxy() *proxy.ReverseProxy {
+	p, err := proxy.NewReverseProxy("https://httpbin.org")
+	if err != nil {
+		log.Fatalf("Error creating httpbin proxy: %s", err)
+	}
+	p.StripPrefix = "/httpbin"
+	return p
 }
 
 func videoRoute(w *response.Writer, r *request.Request) {
-	video, err := os.ReadFile("./assets/vim.mp4")
+	fileserver.ServeFile(w, r, "./assets/vim.mp4")
+}
+
+func eventsRoute(w *response.Writer, r *request.Request) {
+	stream, err := sse.NewStream(w, r)
 	if err != nil {
-		w.WriteStatusLine(500)
-		hdrs := response.GetDefaultHeaders(0)
-		w.WriteHeaders(hdrs)
-		w.WriteBody([]byte(""))
+		fmt.Println(err)
 		return
 	}
+	defer stream.Close()
+	stream.Heartbeat(15 * time.Second)
 
-	hdrs := response.GetDefaultHeaders(len(video))	
-	hdrs.Set("Content-Type", "video/mp4")
-	err = w.WriteStatusLine(200)
-	if err != nil {
-		fmt.Println(err)
+	count := 0
+	if id, err := strconv.Atoi(stream.LastEventID()); err == nil {
+		count = id
 	}
-	err = w.WriteHeaders(hdrs)
-	if err != nil {
-		fmt.Println(err)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Done():
+			return
+		case t := <-ticker.C:
+			count++
+			err := stream.Send(sse.Event{
+				ID:    strconv.Itoa(count),
+				Event: "tick",
+				Data:  t.Format(time.RFC3339),
+			})
+			if err != nil {
+				return
+			}
+		}
 	}
-	_, err = w.WriteBody(video)
-	if err != nil {
-		fmt.Println(err)
+}
+
+func echoSocket(conn *websocket.Conn, r *request.Request) {
+	defer conn.Close(websocket.CloseNormal, "")
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(msgType, data); err != nil {
+			return
+		}
 	}
-	
 }
 
 func yourProblemRoute(w *response.Writer, r *request.Request) {
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/loadgen"
+)
+
+type headerList []string
+
+func (h *headerList) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerList) Set(val string) error {
+	if !strings.Contains(val, ":") {
+		return fmt.Errorf("header %q must have the form \"Name: value\"", val)
+	}
+	*h = append(*h, val)
+	return nil
+}
+
+func main() {
+	var hdrs headerList
+	method := flag.String("X", "GET", "request method")
+	flag.Var(&hdrs, "H", "request header as \"Name: value\", may be repeated")
+	data := flag.String("d", "", "request body; @file reads it from a file")
+	connections := flag.Int("c", 10, "number of concurrent connections")
+	duration := flag.Duration("duration", 10*time.Second, "how long to send requests for")
+	rate := flag.Float64("rate", 0, "requests per second across all connections, 0 for as fast as possible")
+	oneShot := flag.Bool("one-shot", false, "open a new connection for every request instead of keeping them alive")
+	timeout := flag.Duration("timeout", 10*time.Second, "time limit for each request")
+	insecure := flag.Bool("k", false, "skip TLS certificate verification")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] url\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("loadgen: ")
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rawURL := flag.Arg(0)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	var body []byte
+	if strings.HasPrefix(*data, "@") {
+		b, err := os.ReadFile((*data)[1:])
+		if err != nil {
+			log.Fatalf("couldn't read request body: %s", err.Error())
+		}
+		body = b
+	} else if *data != "" {
+		body = []byte(*data)
+	}
+
+	req, err := client.NewRequest(strings.ToUpper(*method), rawURL, body)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	for _, h := range hdrs {
+		name, val, _ := strings.Cut(h, ":")
+		req.Headers.Set(strings.TrimSpace(name), strings.TrimSpace(val))
+	}
+
+	cfg := loadgen.Config{
+		Request:     req,
+		Connections: *connections,
+		Duration:    *duration,
+		Rate:        *rate,
+		KeepAlive:   !*oneShot,
+		Timeout:     *timeout,
+	}
+	if *insecure {
+		cfg.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	mode := "keep-alive"
+	if *oneShot {
+		mode = "one-shot"
+	}
+	pace := "as fast as possible"
+	if *rate > 0 {
+		pace = fmt.Sprintf("%g req/s", *rate)
+	}
+	fmt.Printf("%s %s for %s, %d %s connections, %s\n\n", req.Method, req.URL, *duration, *connections, mode, pace)
+
+	// Ctrl-C stops early but still prints what was measured so far.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	res, err := loadgen.Run(ctx, cfg)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	res.Report(os.Stdout)
+	if res.Requests == 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/capture"
+	"github.com/alerone/httpfromtcp/internal/client"
+)
+
+type summary struct {
+	matched, differed, failed, skipped int
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:42069", "base url the recorded requests are sent to")
+	timing := flag.Bool("timing", false, "wait between requests as long as the original client did")
+	speed := flag.Float64("speed", 1, "divides the original gaps when -timing is set")
+	compare := flag.String("headers", "Content-Type", "comma separated response headers compared with the recording")
+	timeout := flag.Duration("timeout", 30*time.Second, "time limit for each request")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] capture.jsonl\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("replay: ")
+	if flag.NArg() != 1 || *speed <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base, err := url.Parse(*target)
+	if err != nil || base.Host == "" {
+		log.Fatalf("invalid target %q", *target)
+	}
+	entries, err := readCapture(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	// The recorder writes entries as responses complete, so put them back in
+	// the order the requests arrived.
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].Started.Before(entries[b].Started) })
+	var headerNames []string
+	for _, name := range strings.Split(*compare, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			headerNames = append(headerNames, name)
+		}
+	}
+
+	c := &client.Client{Timeout: *timeout}
+	var sum summary
+	start := time.Now()
+	for i, e := range entries {
+		if *timing && i > 0 {
+			offset := time.Duration(float64(e.Started.Sub(entries[0].Started)) / *speed)
+			time.Sleep(time.Until(start.Add(offset)))
+		}
+		replay(c, i+1, e, base, headerNames, &sum)
+	}
+
+	fmt.Printf("\n%d requests: %d matched, %d differed, %d failed, %d skipped\n",
+		len(entries), sum.matched, sum.differed, sum.failed, sum.skipped)
+	if sum.differed > 0 || sum.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func readCapture(path string) ([]capture.Entry, error) {
+	if path == "-" {
+		return capture.ReadJSONL(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open capture: %s", err.Error())
+	}
+	defer f.Close()
+	return capture.ReadJSONL(f)
+}
+
+func replay(c *client.Client, n int, e capture.Entry, base *url.URL, headerNames []string, sum *summary) {
+	label := fmt.Sprintf("#%d %s %s", n, e.Request.Method, e.Request.Target)
+	if e.Request.Method == "CONNECT" {
+		fmt.Printf("%s  SKIPPED  tunnels can't be replayed\n", label)
+		sum.skipped++
+		return
+	}
+	req, err := capture.ReplayRequest(e, base)
+	if err != nil {
+		fmt.Printf("%s  SKIPPED  %s\n", label, err.Error())
+		sum.skipped++
+		return
+	}
+
+	sent := time.Now()
+	res, err := c.Do(req)
+	if err != nil {
+		fmt.Printf("%s  FAILED  %s\n", label, err.Error())
+		sum.failed++
+		return
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	elapsed := time.Since(sent).Round(time.Millisecond)
+	if err != nil {
+		fmt.Printf("%s  FAILED  reading body: %s\n", label, err.Error())
+		sum.failed++
+		return
+	}
+
+	if e.Response == nil {
+		fmt.Printf("%s  %d  %s  (nothing recorded to compare)\n", label, res.StatusCode, elapsed)
+		sum.skipped++
+		return
+	}
+	diffs := capture.Compare(e.Response, res, body, headerNames)
+	if len(diffs) == 0 {
+		fmt.Printf("%s  %d  %s  ok\n", label, res.StatusCode, elapsed)
+		sum.matched++
+		return
+	}
+	fmt.Printf("%s  %d  %s  DIFF\n", label, res.StatusCode, elapsed)
+	for _, d := range diffs {
+		fmt.Printf("    %s\n", d)
+	}
+	sum.differed++
+}
@@ -1,46 +1,270 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 
+	"github.com/alerone/httpfromtcp/internal/capture"
 	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
 )
 
+const maxRawDump = 4096
+
+var outMu sync.Mutex
+
 func main() {
-	port := ":42069"
-	typeConn := "tcp"
+	addr := flag.String("addr", ":42069", "address to listen on")
+	echo := flag.Bool("echo", false, "reply to every request with a copy of its raw bytes")
+	capturePath := flag.String("capture", "", "append every request/response pair to this JSON Lines file")
+	harPath := flag.String("har", "", "write the captured exchanges to this HAR file on exit")
+	captureBody := flag.Int("capture-body", 64<<10, "maximum number of body bytes kept per captured message")
+	flag.Parse()
 
-	listener, err := net.Listen(typeConn, port)
+	var rec *capture.Recorder
+	if *capturePath != "" || *harPath != "" {
+		var out io.Writer
+		if *capturePath != "" {
+			f, err := os.OpenFile(*capturePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				log.Fatalf("couldn't open capture file: %s", err.Error())
+			}
+			defer f.Close()
+			out = f
+		}
+		rec = capture.NewRecorder(out)
+		rec.MaxBodySize = *captureBody
+	}
+
+	listener, err := net.Listen("tcp", *addr)
 	if err != nil {
-		log.Fatalf("couldn't listen on port %s: %s", port, err.Error())
+		log.Fatalf("couldn't listen on %s: %s", *addr, err.Error())
 	}
-	defer listener.Close()
+	log.Printf("Inspecting requests on %s", listener.Addr())
+
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		<-sigChan
+		listener.Close()
+	}()
 
-	for {
+	for id := 1; ; id++ {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Fatalf("couldnt accept connection: %s", err.Error())
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			log.Printf("couldn't accept connection: %s", err.Error())
+			continue
+		}
+		go inspect(id, conn, *echo, rec)
+	}
+
+	if *harPath != "" {
+		if err := writeHAR(*harPath, rec.Entries()); err != nil {
+			log.Fatalf("couldn't write HAR file: %s", err.Error())
 		}
-		fmt.Println("Connection accepted")
-		rq, err := request.RequestFromReader(conn)
+		log.Printf("Wrote %d exchanges to %s", len(rec.Entries()), *harPath)
+	}
+}
+
+func writeHAR(path string, entries []capture.Entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := capture.WriteHAR(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// inspect reads requests off conn until the client closes it, asks to close
+// it, or sends something that cannot be parsed. Parsed requests are added to
+// rec when it is not nil.
+func inspect(id int, conn net.Conn, echo bool, rec *capture.Recorder) {
+	defer conn.Close()
+	printf("=== conn %d: accepted from %s\n", id, conn.RemoteAddr())
+
+	var leftover []byte
+	for n := 1; ; n++ {
+		var raw bytes.Buffer
+		src := io.TeeReader(io.MultiReader(bytes.NewReader(leftover), conn), &raw)
+		rq, err := request.RequestFromReader(src)
+
+		var out strings.Builder
+		fmt.Fprintf(&out, "=== conn %d: request %d\n", id, n)
 		if err != nil {
-			log.Fatalf("%s", err.Error())
+			var perr *request.ParseError
+			if !errors.As(err, &perr) {
+				printf("=== conn %d: %s\n", id, err.Error())
+				return
+			}
+			// Header errors quote the rest of the buffer, so keep the first line.
+			msg, _, _ := strings.Cut(perr.Err.Error(), "\r\n")
+			fmt.Fprintf(&out, "Parse error at byte %d: %s\n", perr.Offset, msg)
+			writeRaw(&out, raw.Bytes(), perr.Offset)
+			printf("%s", out.String())
+			if echo {
+				body := fmt.Sprintf("parse error at byte %d: %s\n", perr.Offset, msg)
+				w := response.NewWriter(conn)
+				reply(&w, response.BadRequestStatus, "text/plain", []byte(body), false)
+			}
+			return
+		}
+
+		leftover = rq.Buffered()
+		data := raw.Bytes()[:raw.Len()-len(leftover)]
+		if len(data) == 0 {
+			printf("=== conn %d: closed by client\n", id)
+			return
+		}
+		if incomplete(rq, data) {
+			fmt.Fprintf(&out, "Incomplete request: connection closed after %d bytes\n", len(data))
+			writeRaw(&out, data, -1)
+			printf("%s", out.String())
+			return
 		}
 
-		fmt.Println("Request line:")
-		fmt.Printf("- Method: %s\n", rq.RequestLine.Method)
-		fmt.Printf("- Target: %s\n", rq.RequestLine.RequestTarget)
-		fmt.Printf("- Version: %s\n", rq.RequestLine.HttpVersion)
+		writeRaw(&out, data, -1)
+		writeParsed(&out, rq)
+		printf("%s", out.String())
 
-		fmt.Println("Headers:")
-		for key, val := range rq.Headers {
-			fmt.Printf("- %s: %s\n", key, val)
+		connection, _ := rq.Headers.Get("Connection")
+		keepAlive := !hasToken(connection, "close")
+		handler := func(w *response.Writer, _ *request.Request) {
+			if echo {
+				reply(w, response.OkStatus, "message/http", data, keepAlive)
+			}
+		}
+		if rec != nil {
+			rq.ConnID = uint64(id)
+			rq.RemoteAddr = conn.RemoteAddr().String()
+			handler = capture.Record(rec, handler)
 		}
+		w := response.NewWriter(conn)
+		handler(&w, rq)
+		if !keepAlive {
+			printf("=== conn %d: closing as requested\n", id)
+			return
+		}
+	}
+}
 
-		fmt.Println("Body:")
-		fmt.Println(string(rq.Body))
-		fmt.Println("Connection closed")
+func incomplete(rq *request.Request, data []byte) bool {
+	if !bytes.Contains(data, []byte("\r\n\r\n")) {
+		return true
+	}
+	cl, ok := rq.Headers.Get("Content-Length")
+	if !ok {
+		return false
 	}
+	n, _ := strconv.Atoi(cl)
+	return len(rq.Body) < n
+}
+
+// writeRaw prints data one line per row, prefixed by the byte offset of the
+// line, with CR, LF and other control bytes made visible. A non-negative
+// mark points a caret at that offset.
+func writeRaw(out *strings.Builder, data []byte, mark int) {
+	fmt.Fprintf(out, "Raw (%d bytes):\n", len(data))
+	shown := data
+	if len(shown) > maxRawDump {
+		shown = shown[:maxRawDump]
+	}
+
+	marked := false
+	for offset := 0; offset < len(shown); {
+		line := shown[offset:]
+		if i := bytes.IndexByte(line, '\n'); i != -1 {
+			line = line[:i+1]
+		}
+		fmt.Fprintf(out, "%6d  %s\n", offset, visible(line))
+		if mark >= offset && mark < offset+len(line) {
+			fmt.Fprintf(out, "        %s^\n", strings.Repeat(" ", len(visible(line[:mark-offset]))))
+			marked = true
+		}
+		offset += len(line)
+	}
+	if len(data) > len(shown) {
+		fmt.Fprintf(out, "        ... %d more bytes\n", len(data)-len(shown))
+	}
+	if mark >= 0 && !marked {
+		fmt.Fprintf(out, "%6d  ^\n", mark)
+	}
+}
+
+func visible(p []byte) string {
+	var b strings.Builder
+	for _, c := range p {
+		switch {
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func writeParsed(out *strings.Builder, rq *request.Request) {
+	fmt.Fprintln(out, "Request line:")
+	fmt.Fprintf(out, "- Method: %s\n", rq.RequestLine.Method)
+	fmt.Fprintf(out, "- Target: %s\n", rq.RequestLine.RequestTarget)
+	fmt.Fprintf(out, "- Version: %s\n", rq.RequestLine.HttpVersion)
+
+	fmt.Fprintln(out, "Headers:")
+	for _, field := range rq.RawHeaders {
+		fmt.Fprintf(out, "- %s: %s\n", field.Name, field.Value)
+	}
+
+	fmt.Fprintf(out, "Body (%d bytes):\n", len(rq.Body))
+	if len(rq.Body) > 0 {
+		fmt.Fprintln(out, string(rq.Body))
+	}
+}
+
+func reply(w *response.Writer, status response.StatusCode, contentType string, body []byte, keepAlive bool) {
+	w.WriteStatusLine(status)
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", contentType)
+	if keepAlive {
+		h.Set("Connection", "keep-alive")
+	}
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func hasToken(header, token string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func printf(format string, args ...any) {
+	outMu.Lock()
+	defer outMu.Unlock()
+	fmt.Printf(format, args...)
 }
@@ -2,14 +2,64 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/httpu"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
 )
 
 func main() {
-	n, err := net.ResolveUDPAddr("udp", "localhost:42069")
+	addr := flag.String("addr", "", "address to send to or listen on (default localhost:42069, or the SSDP group for -search, -notify and -serve)")
+	search := flag.String("search", "", "send an SSDP M-SEARCH for this target, e.g. ssdp:all, and print the responses")
+	mx := flag.Int("mx", 2, "seconds devices may wait before answering a search")
+	notify := flag.String("notify", "", "send an SSDP NOTIFY announcing this notification type")
+	nts := flag.String("nts", httpu.Alive, "notification sub type for -notify: ssdp:alive or ssdp:byebye")
+	usn := flag.String("usn", "", "unique service name for -notify and -serve")
+	location := flag.String("location", "", "description URL for -notify and -serve")
+	serve := flag.Bool("serve", false, "join the multicast group, answer searches and print every message received")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("udpsender: ")
+
+	switch {
+	case *search != "":
+		runSearch(orDefault(*addr, httpu.SSDPAddr), *search, *mx)
+	case *notify != "":
+		a := httpu.Announcement{NT: *notify, NTS: *nts, USN: *usn, Location: *location}
+		if a.USN == "" {
+			a.USN = *notify
+		}
+		if err := httpu.Notify(orDefault(*addr, httpu.SSDPAddr), a); err != nil {
+			log.Fatalf("%s", err.Error())
+		}
+	case *serve:
+		runServer(orDefault(*addr, httpu.SSDPAddr), *usn, *location)
+	default:
+		sendLines(orDefault(*addr, "localhost:42069"))
+	}
+}
+
+func orDefault(val, def string) string {
+	if val == "" {
+		return def
+	}
+	return val
+}
+
+func sendLines(addr string) {
+	n, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		log.Fatalf("cant resolve udp addr: %s\n", err.Error())
 	}
@@ -33,3 +83,68 @@ func main() {
 		}
 	}
 }
+
+func runSearch(addr, st string, mx int) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	results, err := httpu.Search(ctx, addr, st, mx)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	for _, res := range results {
+		fmt.Printf("from %s: %s %d %s\n", res.Addr, res.Proto, res.StatusCode, res.Reason)
+		printFields(res.Headers)
+		fmt.Println()
+	}
+	fmt.Printf("%d responses\n", len(results))
+}
+
+func runServer(addr, usn, location string) {
+	handler := func(w *response.Writer, req *request.Request) {
+		fmt.Printf("%s from %s: %s %s\n", time.Now().Format(time.TimeOnly), req.RemoteAddr, req.RequestLine.Method, req.RequestLine.RequestTarget)
+		printFields(req.Headers)
+		fmt.Println()
+		if req.RequestLine.Method != "M-SEARCH" {
+			return
+		}
+		st, _ := req.Headers.Get("St")
+		h := headers.NewHeaders()
+		h.Set("Cache-Control", "max-age=1800")
+		h.Set("Ext", "")
+		h.Set("St", st)
+		h.Set("Usn", orDefault(usn, st))
+		h.Set("Location", location)
+		h.Set("Content-Length", "0")
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(h)
+		w.WriteEmptyBody()
+	}
+
+	var srv *httpu.Server
+	var err error
+	if ip, _, splitErr := net.SplitHostPort(addr); splitErr == nil && net.ParseIP(ip).IsMulticast() {
+		srv, err = httpu.ServeMulticast(addr, nil, handler)
+	} else {
+		srv, err = httpu.Serve(addr, handler)
+	}
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	defer srv.Close()
+	log.Printf("listening on %s", addr)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+}
+
+func printFields(h headers.Headers) {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("  %s: %s\n", key, h[key])
+	}
+}
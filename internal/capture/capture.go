@@ -0,0 +1,315 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/compression"
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+const (
+	defaultMaxBodySize = 64 << 10
+	maxHeadSize        = 64 << 10
+	maxDecodedSize     = 16 << 20
+	base64Encoding     = "base64"
+)
+
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Content holds the part of a message shared by requests and responses.
+// BodySize is the full length of the body as sent, which may be more than
+// what was kept in Body when BodyTruncated is set. Decoded responses keep
+// Body with its Content-Encoding removed and DecodedSize as its full length.
+type Content struct {
+	Headers       []Header `json:"headers"`
+	Body          string   `json:"body,omitempty"`
+	BodyEncoding  string   `json:"bodyEncoding,omitempty"`
+	BodySize      int      `json:"bodySize"`
+	BodyTruncated bool     `json:"bodyTruncated,omitempty"`
+	Decoded       bool     `json:"decoded,omitempty"`
+	DecodedSize   int      `json:"decodedSize,omitempty"`
+}
+
+type Request struct {
+	Method  string `json:"method"`
+	Target  string `json:"target"`
+	Version string `json:"httpVersion"`
+	Content
+}
+
+type Response struct {
+	Status  int    `json:"status"`
+	Reason  string `json:"statusText"`
+	Version string `json:"httpVersion"`
+	Content
+}
+
+// Timings are in milliseconds, as in HAR. Wait runs from the moment the
+// handler starts to the first response byte and Receive from there until the
+// handler returns.
+type Timings struct {
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Hijacked is set when the handler took the connection over, as WebSocket
+// upgrades do. Response then only holds what was written before that; the
+// traffic that followed on the raw connection isn't captured.
+type Entry struct {
+	ConnID     uint64    `json:"connId"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Started    time.Time `json:"started"`
+	Request    Request   `json:"request"`
+	Response   *Response `json:"response,omitempty"`
+	Timings    Timings   `json:"timings"`
+	Hijacked   bool      `json:"hijacked,omitempty"`
+}
+
+func (c Content) Header(name string) (string, bool) {
+	for _, h := range c.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+func (c Content) BodyBytes() ([]byte, error) {
+	if c.BodyEncoding == base64Encoding {
+		return base64.StdEncoding.DecodeString(c.Body)
+	}
+	return []byte(c.Body), nil
+}
+
+// Recorder keeps every captured entry in memory for WriteHAR and, when it
+// has an output, also appends each one to it as a JSON line.
+type Recorder struct {
+	// MaxBodySize caps how much of each body is kept; 0 means 64KB.
+	MaxBodySize int
+
+	mu      sync.Mutex
+	out     io.Writer
+	entries []Entry
+}
+
+func NewRecorder(out io.Writer) *Recorder {
+	return &Recorder{out: out}
+}
+
+func (rec *Recorder) Add(e Entry) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.entries = append(rec.entries, e)
+	if rec.out == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding capture entry: %s", err.Error())
+	}
+	_, err = rec.out.Write(append(line, '\n'))
+	return err
+}
+
+func (rec *Recorder) Entries() []Entry {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]Entry(nil), rec.entries...)
+}
+
+func (rec *Recorder) maxBodySize() int {
+	if rec.MaxBodySize > 0 {
+		return rec.MaxBodySize
+	}
+	return defaultMaxBodySize
+}
+
+func ReadJSONL(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	dec := json.NewDecoder(r)
+	for {
+		var e Entry
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding capture entry %d: %s", len(entries)+1, err.Error())
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Record captures every request handled by next together with the response
+// bytes it writes, and adds the pair to rec once next returns.
+func Record(rec *Recorder, next server.Handler) server.Handler {
+	return func(w *response.Writer, r *request.Request) {
+		maxBody := rec.maxBodySize()
+		entry := Entry{
+			ConnID:     r.ConnID,
+			RemoteAddr: r.RemoteAddr,
+			Started:    time.Now(),
+			Request:    captureRequest(r, maxBody),
+		}
+		// Chunk framing and content codings make the wire bytes larger than
+		// the body, so keep some room before giving up on the copy.
+		wire := &wireBuffer{limit: maxHeadSize + 2*maxBody}
+		w.Tee(wire)
+		next(w, r)
+		end := time.Now()
+		entry.Hijacked = w.Hijacked()
+
+		if wire.total == 0 {
+			entry.Timings.Wait = millis(end.Sub(entry.Started))
+		} else {
+			entry.Response = captureResponse(wire, r.RequestLine.Method, maxBody)
+			entry.Timings.Wait = millis(wire.first.Sub(entry.Started))
+			entry.Timings.Receive = millis(end.Sub(wire.first))
+		}
+		if err := rec.Add(entry); err != nil {
+			log.Printf("Error recording request: %s", err.Error())
+		}
+	}
+}
+
+func captureRequest(r *request.Request, maxBody int) Request {
+	fields := make([]Header, 0, len(r.RawHeaders))
+	for _, f := range r.RawHeaders {
+		fields = append(fields, Header{Name: f.Name, Value: f.Value})
+	}
+	if len(fields) == 0 {
+		fields = sortedFields(r.Headers)
+	}
+	return Request{
+		Method:  r.RequestLine.Method,
+		Target:  r.RequestLine.RequestTarget,
+		Version: r.RequestLine.HttpVersion,
+		Content: newContent(fields, r.Body, maxBody),
+	}
+}
+
+func sortedFields(h headers.Headers) []Header {
+	fields := make([]Header, 0, len(h))
+	for key, val := range h {
+		fields = append(fields, Header{Name: key, Value: val})
+	}
+	sort.Slice(fields, func(a, b int) bool { return fields[a].Name < fields[b].Name })
+	return fields
+}
+
+func captureResponse(wire *wireBuffer, method string, maxBody int) *Response {
+	raw := wire.buf.Bytes()
+	res, err := client.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), method)
+	if err != nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, int64(maxBody)+1))
+	truncated := wire.total > wire.buf.Len() || len(body) > maxBody
+
+	fields := headLines(raw)
+	coding, _ := res.Headers.Get("Content-Encoding")
+	if !truncated && err == nil && coding != "" {
+		// Compressed bytes are of little use when reading a capture, so
+		// store what the handler meant to send.
+		if decoded, derr := compression.DecodeBody(body, coding, maxDecodedSize); derr == nil {
+			content := newContent(fields, decoded, maxBody)
+			content.Decoded = true
+			content.DecodedSize = len(decoded)
+			content.BodySize = len(body)
+			return newResponse(res, content)
+		}
+	}
+
+	content := newContent(fields, body, maxBody)
+	switch {
+	case !truncated && err == nil:
+	case res.ContentLength >= 0:
+		content.BodySize = int(res.ContentLength)
+	default:
+		content.BodySize = -1
+	}
+	content.BodyTruncated = content.BodyTruncated || truncated
+	return newResponse(res, content)
+}
+
+func newResponse(res *client.Response, content Content) *Response {
+	return &Response{
+		Status:  int(res.StatusCode),
+		Reason:  res.Reason,
+		Version: strings.TrimPrefix(res.Proto, "HTTP/"),
+		Content: content,
+	}
+}
+
+// headLines returns the header fields of the response in raw, in the order
+// they were written.
+func headLines(raw []byte) []Header {
+	head, _, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+	lines := strings.Split(string(head), "\r\n")
+	fields := make([]Header, 0, len(lines))
+	for _, line := range lines[1:] {
+		name, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields = append(fields, Header{Name: strings.TrimSpace(name), Value: strings.TrimSpace(val)})
+	}
+	return fields
+}
+
+func newContent(fields []Header, body []byte, maxBody int) Content {
+	c := Content{Headers: fields, BodySize: len(body)}
+	if len(body) > maxBody {
+		body = body[:maxBody]
+		c.BodyTruncated = true
+	}
+	if utf8.Valid(body) {
+		c.Body = string(body)
+	} else {
+		c.Body = base64.StdEncoding.EncodeToString(body)
+		c.BodyEncoding = base64Encoding
+	}
+	return c
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// wireBuffer keeps the first limit bytes written to it and counts the rest.
+type wireBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	total int
+	first time.Time
+}
+
+func (wb *wireBuffer) Write(p []byte) (int, error) {
+	if wb.total == 0 && len(p) > 0 {
+		wb.first = time.Now()
+	}
+	wb.total += len(p)
+	if room := wb.limit - wb.buf.Len(); room > 0 {
+		wb.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
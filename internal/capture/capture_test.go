@@ -0,0 +1,242 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/compression"
+	"github.com/alerone/httpfromtcp/internal/cookie"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler server.Handler) string {
+	t.Helper()
+	srv, err := server.Serve(0, handler)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return fmt.Sprintf("http://127.0.0.1:%d", srv.Addr().(*net.TCPAddr).Port)
+}
+
+func send(t *testing.T, method, url string, body []byte, hdrs ...string) {
+	t.Helper()
+	req, err := client.NewRequest(method, url, body)
+	require.NoError(t, err)
+	for i := 0; i+1 < len(hdrs); i += 2 {
+		req.Headers.Set(hdrs[i], hdrs[i+1])
+	}
+	res, err := (&client.Client{DisableKeepAlives: true}).Do(req)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	res.Body.Close()
+}
+
+func chunkedHandler(w *response.Writer, r *request.Request) {
+	w.WriteStatusLine(response.OkStatus)
+	w.SetCookie(&cookie.Cookie{Name: "id", Value: "7"})
+	hdrs := response.GetDefaultHeaders(0)
+	hdrs.Remove("Content-Length")
+	hdrs.Set("Transfer-Encoding", "chunked")
+	w.WriteHeaders(hdrs)
+	w.WriteChunkedBody([]byte("hello, "))
+	w.WriteChunkedBody(r.Body)
+	w.WriteChunkedBodyDone()
+}
+
+func TestRecordCapturesExchange(t *testing.T) {
+	var jsonl bytes.Buffer
+	rec := NewRecorder(&jsonl)
+	url := startServer(t, Record(rec, chunkedHandler))
+
+	send(t, "POST", url+"/greet?who=me", []byte("world"), "X-First", "1", "Content-Type", "text/plain")
+	send(t, "POST", url+"/greet", []byte("again"))
+
+	entries := rec.Entries()
+	require.Len(t, entries, 2)
+	e := entries[0]
+	assert.NotZero(t, e.ConnID)
+	assert.NotEqual(t, e.ConnID, entries[1].ConnID)
+	assert.NotEmpty(t, e.RemoteAddr)
+	assert.Equal(t, "POST", e.Request.Method)
+	assert.Equal(t, "/greet?who=me", e.Request.Target)
+	assert.Equal(t, "Host", e.Request.Headers[0].Name)
+	assert.Equal(t, "world", e.Request.Body)
+	assert.Equal(t, 5, e.Request.BodySize)
+
+	require.NotNil(t, e.Response)
+	assert.Equal(t, 200, e.Response.Status)
+	assert.Equal(t, "OK", e.Response.Reason)
+	assert.Equal(t, "hello, world", e.Response.Body)
+	assert.Equal(t, 12, e.Response.BodySize)
+	assert.False(t, e.Response.BodyTruncated)
+	setCookie, ok := e.Response.Header("Set-Cookie")
+	assert.True(t, ok)
+	assert.Equal(t, "id=7", setCookie)
+	assert.Equal(t, "Set-Cookie", e.Response.Headers[len(e.Response.Headers)-1].Name)
+	assert.GreaterOrEqual(t, e.Timings.Wait, 0.0)
+	assert.GreaterOrEqual(t, e.Timings.Receive, 0.0)
+
+	replayed, err := ReadJSONL(&jsonl)
+	require.NoError(t, err)
+	require.Len(t, replayed, 2)
+	assert.Equal(t, e.Request, replayed[0].Request)
+	assert.Equal(t, *e.Response, *replayed[0].Response)
+	assert.True(t, e.Started.Equal(replayed[0].Started))
+}
+
+func TestRecordTruncatesBodies(t *testing.T) {
+	rec := NewRecorder(nil)
+	rec.MaxBodySize = 4
+	url := startServer(t, Record(rec, chunkedHandler))
+
+	send(t, "PUT", url+"/", []byte("a long request body"))
+
+	e := rec.Entries()[0]
+	assert.Equal(t, "a lo", e.Request.Body)
+	assert.Equal(t, 19, e.Request.BodySize)
+	assert.True(t, e.Request.BodyTruncated)
+	assert.Equal(t, "hell", e.Response.Body)
+	assert.True(t, e.Response.BodyTruncated)
+}
+
+func TestBinaryBodiesAreBase64(t *testing.T) {
+	rec := NewRecorder(nil)
+	url := startServer(t, Record(rec, chunkedHandler))
+	payload := []byte{0xff, 0x00, 0xfe}
+
+	send(t, "POST", url+"/", payload)
+
+	e := rec.Entries()[0]
+	assert.Equal(t, "base64", e.Request.BodyEncoding)
+	body, err := e.Request.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, payload, body)
+	body, err = e.Response.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte("hello, "), payload...), body)
+}
+
+func TestRecordWithoutResponse(t *testing.T) {
+	rec := NewRecorder(nil)
+	r, err := request.RequestFromReader(strings.NewReader("GET /x HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.NoError(t, err)
+	w := response.NewWriter(io.Discard)
+
+	Record(rec, func(*response.Writer, *request.Request) {})(&w, r)
+
+	e := rec.Entries()[0]
+	assert.Nil(t, e.Response)
+	assert.Equal(t, []Header{{Name: "Host", Value: "example.com"}}, e.Request.Headers)
+}
+
+func TestRecordMarksHijackedConnections(t *testing.T) {
+	rec := NewRecorder(nil)
+	url := startServer(t, Record(rec, func(w *response.Writer, r *request.Request) {
+		w.WriteStatusLine(response.SwitchingProtocolsStatus)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		w.WriteEmptyBody()
+		raw, _, err := w.Hijack()
+		if err != nil {
+			return
+		}
+		raw.Write([]byte("raw bytes"))
+		raw.Close()
+	}))
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(got), "raw bytes"))
+
+	require.Eventually(t, func() bool { return len(rec.Entries()) == 1 }, time.Second, 10*time.Millisecond)
+	e := rec.Entries()[0]
+	assert.True(t, e.Hijacked)
+	require.NotNil(t, e.Response)
+	assert.Equal(t, 101, e.Response.Status)
+	assert.Empty(t, e.Response.Body)
+}
+
+func TestRecordKeepsFlushing(t *testing.T) {
+	release := make(chan struct{})
+	rec := NewRecorder(nil)
+	url := startServer(t, Record(rec, func(w *response.Writer, r *request.Request) {
+		w.WriteStatusLine(response.OkStatus)
+		hdrs := response.GetDefaultHeaders(0)
+		hdrs.Remove("Content-Length")
+		hdrs.Set("Content-Type", "text/event-stream")
+		hdrs.Set("Transfer-Encoding", "chunked")
+		w.WriteHeaders(hdrs)
+		w.WriteChunkedBody([]byte("data: first\n\n"))
+		w.Flush()
+		<-release
+		w.WriteChunkedBodyDone()
+	}))
+	defer close(release)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /events HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var got []byte
+	buf := make([]byte, 512)
+	for !bytes.Contains(got, []byte("data: first")) {
+		n, err := conn.Read(buf)
+		require.NoError(t, err, "event not flushed before the handler returned")
+		got = append(got, buf[:n]...)
+	}
+}
+
+func TestRecordDecodesCompressedBodies(t *testing.T) {
+	text := strings.Repeat("hello, compressed world\n", 50)
+	rec := NewRecorder(nil)
+	url := startServer(t, Record(rec, compression.Compress(func(w *response.Writer, r *request.Request) {
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(response.GetDefaultHeaders(len(text)))
+		w.WriteBody([]byte(text))
+	})))
+	send(t, "GET", url+"/text", nil, "Accept-Encoding", "gzip")
+
+	e := rec.Entries()[0]
+	require.NotNil(t, e.Response)
+	coding, _ := e.Response.Header("Content-Encoding")
+	assert.Equal(t, "gzip", coding)
+	assert.True(t, e.Response.Decoded)
+	assert.Equal(t, text, e.Response.Body)
+	assert.Empty(t, e.Response.BodyEncoding)
+	assert.Equal(t, len(text), e.Response.DecodedSize)
+	assert.Less(t, e.Response.BodySize, len(text))
+
+	target, err := neturl.Parse(url)
+	require.NoError(t, err)
+	req, err := ReplayRequest(e, target)
+	require.NoError(t, err)
+	res, err := client.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Empty(t, Compare(e.Response, res, body, []string{"Content-Encoding"}))
+
+	var har bytes.Buffer
+	require.NoError(t, WriteHAR(&har, rec.Entries()))
+	assert.Contains(t, har.String(), fmt.Sprintf(`"size": %d`, len(text)))
+	assert.Contains(t, har.String(), fmt.Sprintf(`"compression": %d`, len(text)-e.Response.BodySize))
+}
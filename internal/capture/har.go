@@ -0,0 +1,244 @@
+package capture
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/cookie"
+)
+
+const harVersion = "1.2"
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Connection      string      `json:"connection,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []Header       `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Params   []harNameValue `json:"params"`
+	Text     string         `json:"text"`
+	Comment  string         `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []Header       `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size        int    `json:"size"`
+	Compression int    `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// WriteHAR writes entries as a HAR 1.2 log. Requests that got no response
+// are exported with status 0, the way browsers record aborted requests.
+func WriteHAR(w io.Writer, entries []Entry) error {
+	hl := harLog{
+		Version: harVersion,
+		Creator: harCreator{Name: "httpfromtcp", Version: "devel"},
+		Entries: make([]harEntry, 0, len(entries)),
+	}
+	for _, e := range entries {
+		hl.Entries = append(hl.Entries, harEntryFrom(e))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]harLog{"log": hl})
+}
+
+func harEntryFrom(e Entry) harEntry {
+	he := harEntry{
+		StartedDateTime: e.Started.Format(time.RFC3339Nano),
+		Time:            e.Timings.Wait + e.Timings.Receive,
+		Request:         harRequestFrom(e.Request),
+		Response:        harResponseFrom(e.Response),
+		Timings:         harTimings{Wait: e.Timings.Wait, Receive: e.Timings.Receive},
+		Connection:      strconv.FormatUint(e.ConnID, 10),
+	}
+	var notes []string
+	if e.RemoteAddr != "" {
+		notes = append(notes, "client "+e.RemoteAddr)
+	}
+	if e.Hijacked {
+		notes = append(notes, "connection hijacked, later traffic not captured")
+	}
+	he.Comment = strings.Join(notes, "; ")
+	return he
+}
+
+func harRequestFrom(r Request) harRequest {
+	hr := harRequest{
+		Method:      r.Method,
+		URL:         requestURL(r),
+		HTTPVersion: "HTTP/" + r.Version,
+		Cookies:     []harNameValue{},
+		Headers:     nonNil(r.Headers),
+		QueryString: queryString(r.Target),
+		HeadersSize: -1,
+		BodySize:    r.BodySize,
+	}
+	if header, ok := r.Header("Cookie"); ok {
+		for _, c := range cookie.Parse(header) {
+			hr.Cookies = append(hr.Cookies, harNameValue{Name: c.Name, Value: c.Value})
+		}
+	}
+	if r.BodySize > 0 {
+		mimeType, _ := r.Header("Content-Type")
+		hr.PostData = &harPostData{
+			MimeType: mimeType,
+			Params:   []harNameValue{},
+			Text:     r.Body,
+			Comment:  bodyComment(r.Content),
+		}
+	}
+	return hr
+}
+
+func harResponseFrom(r *Response) harResponse {
+	if r == nil {
+		return harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []Header{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+	}
+	hr := harResponse{
+		Status:      r.Status,
+		StatusText:  r.Reason,
+		HTTPVersion: "HTTP/" + r.Version,
+		Cookies:     []harNameValue{},
+		Headers:     nonNil(r.Headers),
+		HeadersSize: -1,
+		BodySize:    r.BodySize,
+	}
+	for _, h := range r.Headers {
+		if !strings.EqualFold(h.Name, "Set-Cookie") {
+			continue
+		}
+		if c, err := cookie.ParseSetCookie(h.Value); err == nil {
+			hr.Cookies = append(hr.Cookies, harNameValue{Name: c.Name, Value: c.Value})
+		}
+	}
+	hr.Content.Size = r.BodySize
+	if r.Decoded {
+		hr.Content.Size = r.DecodedSize
+		hr.Content.Compression = r.DecodedSize - r.BodySize
+	}
+	hr.Content.MimeType, _ = r.Header("Content-Type")
+	hr.Content.Text = r.Body
+	hr.Content.Encoding = r.BodyEncoding
+	hr.Content.Comment = bodyComment(r.Content)
+	hr.RedirectURL, _ = r.Header("Location")
+	return hr
+}
+
+func requestURL(r Request) string {
+	if strings.Contains(r.Target, "://") {
+		return r.Target
+	}
+	if !strings.HasPrefix(r.Target, "/") {
+		return "http://" + r.Target
+	}
+	host, _ := r.Header("Host")
+	return "http://" + host + r.Target
+}
+
+// queryString keeps the parameters in the order they appear in the target,
+// which url.ParseQuery would lose.
+func queryString(target string) []harNameValue {
+	params := []harNameValue{}
+	_, query, ok := strings.Cut(target, "?")
+	if !ok {
+		return params
+	}
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		params = append(params, harNameValue{Name: name, Value: value})
+	}
+	return params
+}
+
+func bodyComment(c Content) string {
+	switch {
+	case c.BodyTruncated && c.BodyEncoding == base64Encoding:
+		return "body truncated, base64 encoded"
+	case c.BodyTruncated:
+		return "body truncated"
+	case c.BodyEncoding == base64Encoding:
+		return "body base64 encoded"
+	}
+	return ""
+}
+
+func nonNil(fields []Header) []Header {
+	if fields == nil {
+		return []Header{}
+	}
+	return fields
+}
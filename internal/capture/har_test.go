@@ -0,0 +1,115 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHAR(t *testing.T) {
+	entries := []Entry{
+		{
+			ConnID:     3,
+			RemoteAddr: "127.0.0.1:5000",
+			Started:    time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC),
+			Request: Request{
+				Method:  "POST",
+				Target:  "/login?b=2&a=%201",
+				Version: "1.1",
+				Content: Content{
+					Headers: []Header{
+						{Name: "Host", Value: "example.com"},
+						{Name: "Cookie", Value: "theme=dark; lang=en"},
+						{Name: "Content-Type", Value: "application/json"},
+					},
+					Body:     `{"user":"gopher"}`,
+					BodySize: 17,
+				},
+			},
+			Response: &Response{
+				Status:  303,
+				Reason:  "See Other",
+				Version: "1.1",
+				Content: Content{
+					Headers: []Header{
+						{Name: "Location", Value: "/home"},
+						{Name: "Content-Type", Value: "text/plain"},
+						{Name: "Set-Cookie", Value: "session=abc; HttpOnly"},
+					},
+					Body:          "bye",
+					BodySize:      10,
+					BodyTruncated: true,
+				},
+			},
+			Timings: Timings{Wait: 1.5, Receive: 0.25},
+		},
+		{
+			ConnID:  4,
+			Started: time.Date(2026, time.March, 1, 12, 0, 1, 0, time.UTC),
+			Request: Request{Method: "GET", Target: "/", Version: "1.1"},
+		},
+		{
+			ConnID:     5,
+			RemoteAddr: "127.0.0.1:5001",
+			Started:    time.Date(2026, time.March, 1, 12, 0, 2, 0, time.UTC),
+			Request:    Request{Method: "GET", Target: "/ws", Version: "1.1"},
+			Response:   &Response{Status: 101, Reason: "Switching Protocols", Version: "1.1"},
+			Hijacked:   true,
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, WriteHAR(&out, entries))
+
+	var doc struct {
+		Log struct {
+			Version string `json:"version"`
+			Entries []struct {
+				StartedDateTime string      `json:"startedDateTime"`
+				Time            float64     `json:"time"`
+				Connection      string      `json:"connection"`
+				Comment         string      `json:"comment"`
+				Request         harRequest  `json:"request"`
+				Response        harResponse `json:"response"`
+				Timings         harTimings  `json:"timings"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &doc))
+	assert.Equal(t, "1.2", doc.Log.Version)
+	require.Len(t, doc.Log.Entries, 3)
+
+	e := doc.Log.Entries[0]
+	assert.Equal(t, "2026-03-01T12:00:00Z", e.StartedDateTime)
+	assert.Equal(t, 1.75, e.Time)
+	assert.Equal(t, "3", e.Connection)
+	assert.Equal(t, "client 127.0.0.1:5000", e.Comment)
+	assert.Equal(t, "http://example.com/login?b=2&a=%201", e.Request.URL)
+	assert.Equal(t, "HTTP/1.1", e.Request.HTTPVersion)
+	assert.Equal(t, []harNameValue{{"b", "2"}, {"a", " 1"}}, e.Request.QueryString)
+	assert.Equal(t, []harNameValue{{"theme", "dark"}, {"lang", "en"}}, e.Request.Cookies)
+	require.NotNil(t, e.Request.PostData)
+	assert.Equal(t, "application/json", e.Request.PostData.MimeType)
+	assert.Equal(t, `{"user":"gopher"}`, e.Request.PostData.Text)
+
+	assert.Equal(t, 303, e.Response.Status)
+	assert.Equal(t, "/home", e.Response.RedirectURL)
+	assert.Equal(t, []harNameValue{{"session", "abc"}}, e.Response.Cookies)
+	assert.Equal(t, "text/plain", e.Response.Content.MimeType)
+	assert.Equal(t, 10, e.Response.Content.Size)
+	assert.Equal(t, "body truncated", e.Response.Content.Comment)
+	assert.Equal(t, 1.5, e.Timings.Wait)
+
+	aborted := doc.Log.Entries[1]
+	assert.Equal(t, 0, aborted.Response.Status)
+	assert.Nil(t, aborted.Request.PostData)
+	assert.NotNil(t, aborted.Request.QueryString)
+
+	hijacked := doc.Log.Entries[2]
+	assert.Equal(t, 101, hijacked.Response.Status)
+	assert.Equal(t, "client 127.0.0.1:5001; connection hijacked, later traffic not captured", hijacked.Comment)
+}
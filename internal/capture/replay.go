@@ -0,0 +1,154 @@
+package capture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/compression"
+)
+
+// Diff is one way a replayed response differs from the recorded one.
+type Diff struct {
+	Field    string
+	Recorded string
+	Got      string
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("%s: recorded %s, got %s", d.Field, d.Recorded, d.Got)
+}
+
+// ReplayRequest builds a request that re-sends the recorded one to target.
+// Host and the framing headers are left for the client to fill in for the
+// new server. Hijacked entries can't be replayed as an exchange.
+func ReplayRequest(e Entry, target *url.URL) (*client.Request, error) {
+	if e.Hijacked {
+		return nil, fmt.Errorf("connection was hijacked, only the response head was recorded")
+	}
+	body, err := e.Request.BodyBytes()
+	if err != nil {
+		return nil, fmt.Errorf("decoding recorded body: %s", err.Error())
+	}
+	if e.Request.BodyTruncated {
+		return nil, fmt.Errorf("recorded body was truncated to %d of %d bytes", len(body), e.Request.BodySize)
+	}
+
+	ref, err := url.Parse(e.Request.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded target %q: %s", e.Request.Target, err.Error())
+	}
+	u := *target
+	u.Path = strings.TrimSuffix(target.Path, "/") + ref.Path
+	u.RawPath = ""
+	u.RawQuery = ref.RawQuery
+
+	req, err := client.NewRequest(e.Request.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range e.Request.Headers {
+		switch strings.ToLower(h.Name) {
+		case "host", "content-length", "transfer-encoding", "connection", "keep-alive":
+			continue
+		}
+		if prev, ok := req.Headers.Get(h.Name); ok {
+			req.Headers.Set(h.Name, prev, h.Value)
+		} else {
+			req.Headers.Set(h.Name, h.Value)
+		}
+	}
+	return req, nil
+}
+
+// Compare checks the status, the named headers and the body of a replayed
+// response against the recorded one. When the recorded body was truncated
+// only that many leading bytes of the new body are compared.
+func Compare(recorded *Response, got *client.Response, body []byte, headerNames []string) []Diff {
+	var diffs []Diff
+	if recorded.Status != int(got.StatusCode) {
+		diffs = append(diffs, Diff{
+			Field:    "status",
+			Recorded: strconv.Itoa(recorded.Status),
+			Got:      strconv.Itoa(int(got.StatusCode)),
+		})
+	}
+
+	for _, name := range headerNames {
+		want, wantOK := recorded.Header(name)
+		have, haveOK := got.Headers.Get(name)
+		if strings.EqualFold(name, "Set-Cookie") {
+			want, wantOK = joinedHeader(recorded.Headers, name)
+			have, haveOK = strings.Join(got.SetCookies, ", "), len(got.SetCookies) > 0
+		}
+		if want != have || wantOK != haveOK {
+			diffs = append(diffs, Diff{
+				Field:    "header " + name,
+				Recorded: quoteHeader(want, wantOK),
+				Got:      quoteHeader(have, haveOK),
+			})
+		}
+	}
+
+	want, err := recorded.BodyBytes()
+	if err != nil {
+		return append(diffs, Diff{Field: "body", Recorded: "undecodable (" + err.Error() + ")", Got: describeBody(body, len(body))})
+	}
+	size := recorded.BodySize
+	if recorded.Decoded {
+		// Compressed output depends on the encoder, so compare what it
+		// decodes to.
+		size = recorded.DecodedSize
+		if coding, ok := got.Headers.Get("Content-Encoding"); ok {
+			decoded, err := compression.DecodeBody(body, coding, maxDecodedSize)
+			if err != nil {
+				return append(diffs, Diff{Field: "body", Recorded: describeBody(want, size), Got: "undecodable (" + err.Error() + ")"})
+			}
+			body = decoded
+		}
+	}
+	compared := body
+	if recorded.BodyTruncated && len(compared) > len(want) {
+		compared = compared[:len(want)]
+	}
+	sizeMatches := size < 0 || size == len(body)
+	if !bytes.Equal(want, compared) || !sizeMatches {
+		diffs = append(diffs, Diff{
+			Field:    "body",
+			Recorded: describeBody(want, size),
+			Got:      describeBody(compared, len(body)),
+		})
+	}
+	return diffs
+}
+
+func joinedHeader(fields []Header, name string) (string, bool) {
+	var values []string
+	for _, h := range fields {
+		if strings.EqualFold(h.Name, name) {
+			values = append(values, h.Value)
+		}
+	}
+	return strings.Join(values, ", "), len(values) > 0
+}
+
+func quoteHeader(val string, ok bool) string {
+	if !ok {
+		return "(absent)"
+	}
+	return strconv.Quote(val)
+}
+
+func describeBody(body []byte, size int) string {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])[:16]
+	if size >= 0 && size != len(body) {
+		return fmt.Sprintf("sha256 %s of first %d of %d bytes", hash, len(body), size)
+	}
+	return fmt.Sprintf("sha256 %s, %d bytes", hash, len(body))
+}
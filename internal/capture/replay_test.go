@@ -0,0 +1,154 @@
+package capture
+
+import (
+	"bufio"
+	"io"
+	neturl "net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayRequest(t *testing.T) {
+	target, err := neturl.Parse("http://127.0.0.1:9000/base/")
+	require.NoError(t, err)
+	e := Entry{Request: Request{
+		Method:  "POST",
+		Target:  "/items?id=1&x=%20",
+		Version: "1.1",
+		Content: Content{
+			Headers: []Header{
+				{Name: "Host", Value: "recorded.example"},
+				{Name: "Accept", Value: "text/html"},
+				{Name: "Content-Length", Value: "4"},
+				{Name: "Connection", Value: "keep-alive"},
+				{Name: "Accept", Value: "*/*"},
+			},
+			Body:     "data",
+			BodySize: 4,
+		},
+	}}
+
+	req, err := ReplayRequest(e, target)
+	require.NoError(t, err)
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "http://127.0.0.1:9000/base/items?id=1&x=%20", req.URL.String())
+	assert.Equal(t, "127.0.0.1:9000", req.Host())
+	accept, _ := req.Headers.Get("Accept")
+	assert.Equal(t, "text/html, */*", accept)
+	_, ok := req.Headers.Get("Connection")
+	assert.False(t, ok)
+	assert.Equal(t, "data", string(req.Body))
+
+	e.Request.BodyTruncated = true
+	e.Request.BodySize = 100
+	_, err = ReplayRequest(e, target)
+	assert.Error(t, err)
+
+	e.Request.BodyTruncated = false
+	e.Request.BodySize = 4
+	e.Hijacked = true
+	_, err = ReplayRequest(e, target)
+	assert.Error(t, err)
+}
+
+func liveResponse(t *testing.T, raw string) (*client.Response, []byte) {
+	t.Helper()
+	res, err := client.ReadResponse(bufio.NewReader(strings.NewReader(raw)), "GET")
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, body
+}
+
+func TestCompare(t *testing.T) {
+	recorded := &Response{
+		Status:  200,
+		Version: "1.1",
+		Content: Content{
+			Headers: []Header{
+				{Name: "Content-Type", Value: "text/plain"},
+				{Name: "Set-Cookie", Value: "a=1"},
+			},
+			Body:     "hello",
+			BodySize: 5,
+		},
+	}
+	names := []string{"Content-Type", "Set-Cookie", "ETag"}
+
+	res, body := liveResponse(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nSet-Cookie: a=1\r\nContent-Length: 5\r\n\r\nhello")
+	assert.Empty(t, Compare(recorded, res, body, names))
+
+	res, body = liveResponse(t, "HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/html\r\nETag: \"x\"\r\nContent-Length: 6\r\n\r\nhello!")
+	diffs := Compare(recorded, res, body, names)
+	require.Len(t, diffs, 5)
+	assert.Equal(t, "status: recorded 200, got 500", diffs[0].String())
+	assert.Equal(t, `header Content-Type: recorded "text/plain", got "text/html"`, diffs[1].String())
+	assert.Equal(t, `header Set-Cookie: recorded "a=1", got (absent)`, diffs[2].String())
+	assert.Equal(t, `header ETag: recorded (absent), got "\"x\""`, diffs[3].String())
+	assert.Equal(t, "body", diffs[4].Field)
+	assert.Contains(t, diffs[4].Got, "6 bytes")
+}
+
+func TestCompareTruncatedBody(t *testing.T) {
+	recorded := &Response{Status: 200, Content: Content{Body: "hel", BodySize: 5, BodyTruncated: true}}
+
+	res, body := liveResponse(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")
+	assert.Empty(t, Compare(recorded, res, body, nil))
+
+	res, body = liveResponse(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nHELLO")
+	diffs := Compare(recorded, res, body, nil)
+	require.Len(t, diffs, 1)
+	assert.Contains(t, diffs[0].Recorded, "first 3 of 5 bytes")
+}
+
+func TestReplayAgainstRecordedServer(t *testing.T) {
+	rec := NewRecorder(nil)
+	var changed atomic.Bool
+	url := startServer(t, Record(rec, func(w *response.Writer, r *request.Request) {
+		if !changed.Load() {
+			chunkedHandler(w, r)
+			return
+		}
+		w.WriteStatusLine(response.OkStatus)
+		hdrs := response.GetDefaultHeaders(0)
+		hdrs.Set("Content-Type", "text/html")
+		hdrs.Remove("Content-Length")
+		w.WriteHeaders(hdrs)
+		w.WriteBody([]byte("HELLO, " + string(r.Body)))
+	}))
+	send(t, "POST", url+"/greet", []byte("world"))
+	send(t, "GET", url+"/other", nil)
+	entries := rec.Entries()[:2]
+
+	target, err := neturl.Parse(url)
+	require.NoError(t, err)
+	replay := func() [][]Diff {
+		var all [][]Diff
+		for _, e := range entries {
+			req, err := ReplayRequest(e, target)
+			require.NoError(t, err)
+			res, err := client.DefaultClient.Do(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			res.Body.Close()
+			all = append(all, Compare(e.Response, res, body, []string{"Content-Type"}))
+		}
+		return all
+	}
+
+	assert.Equal(t, [][]Diff{nil, nil}, replay())
+
+	changed.Store(true)
+	diffs := replay()
+	require.Len(t, diffs[0], 2)
+	assert.Equal(t, "header Content-Type", diffs[0][0].Field)
+	assert.Equal(t, "body", diffs[0][1].Field)
+}
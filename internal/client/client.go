@@ -0,0 +1,344 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/response"
+)
+
+const defaultDialTimeout = 30 * time.Second
+
+type Client struct {
+	// Timeout bounds the whole exchange, including reading the body.
+	Timeout             time.Duration
+	DialTimeout         time.Duration
+	TLSConfig           *tls.Config
+	DisableKeepAlives   bool
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	FollowRedirects     bool
+	MaxRedirects        int
+	Jar                 *Jar
+	// WrapConn, if set, wraps every new connection after the TLS handshake,
+	// which lets callers observe the raw bytes on the wire.
+	WrapConn func(net.Conn) net.Conn
+
+	pool connPool
+}
+
+const defaultMaxRedirects = 10
+
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+var DefaultClient = &Client{}
+
+func Get(rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultClient.Do(req)
+}
+
+func (c *Client) Do(req *Request) (*Response, error) {
+	origHost := canonicalHost(req.URL.Hostname())
+	for hops := 0; ; hops++ {
+		res, err := c.send(c.withJarCookies(req))
+		if err != nil {
+			return nil, err
+		}
+		res.Request = req
+		if c.Jar != nil && len(res.SetCookies) > 0 {
+			c.Jar.SetCookies(req.URL, res.SetCookies)
+		}
+
+		location, ok := res.Headers.Get("Location")
+		if !c.FollowRedirects || !ok || !isRedirect(res.StatusCode) {
+			return res, nil
+		}
+		if hops >= c.maxRedirects() {
+			res.Body.Close()
+			return nil, fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, hops)
+		}
+		next, err := redirectRequest(req, res.StatusCode, location, origHost)
+		io.CopyN(io.Discard, res.Body, 4<<10)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = next
+	}
+}
+
+func (c *Client) withJarCookies(req *Request) *Request {
+	if c.Jar == nil {
+		return req
+	}
+	cookies := c.Jar.Cookies(req.URL)
+	if len(cookies) == 0 {
+		return req
+	}
+	pairs := make([]string, 0, len(cookies)+1)
+	if own, ok := req.Headers.Get("Cookie"); ok && own != "" {
+		pairs = append(pairs, own)
+	}
+	for _, ck := range cookies {
+		pairs = append(pairs, ck.Name+"="+ck.Value)
+	}
+	r2 := *req
+	r2.Headers = cloneHeaders(req.Headers)
+	r2.Headers.Set("Cookie", strings.Join(pairs, "; "))
+	return &r2
+}
+
+func isRedirect(status response.StatusCode) bool {
+	switch status {
+	case 301, 302, 303, 307, 308:
+		return true
+	}
+	return false
+}
+
+func redirectRequest(prev *Request, status response.StatusCode, location, origHost string) (*Request, error) {
+	u, err := prev.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %q: %s", location, err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported redirect scheme: %q", u.Scheme)
+	}
+	u.Fragment = ""
+
+	next := &Request{
+		Method:  prev.Method,
+		URL:     u,
+		Headers: cloneHeaders(prev.Headers),
+		Body:    prev.Body,
+		ctx:     prev.ctx,
+	}
+	next.Headers.Remove("Host")
+	switch {
+	case status == 303 && prev.Method != "HEAD",
+		(status == 301 || status == 302) && prev.Method == "POST":
+		next.Method = "GET"
+		next.Body = nil
+		next.Headers.Remove("Content-Type")
+		next.Headers.Remove("Content-Encoding")
+	}
+
+	if canonicalHost(u.Hostname()) != origHost {
+		next.Headers.Remove("Authorization")
+		next.Headers.Remove("Proxy-Authorization")
+		next.Headers.Remove("Cookie")
+	}
+	return next, nil
+}
+
+func cloneHeaders(h headers.Headers) headers.Headers {
+	out := headers.NewHeaders()
+	for key, val := range h {
+		out[key] = val
+	}
+	return out
+}
+
+func (c *Client) maxRedirects() int {
+	if c.MaxRedirects > 0 {
+		return c.MaxRedirects
+	}
+	return defaultMaxRedirects
+}
+
+func (c *Client) send(req *Request) (*Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+
+	if c.DisableKeepAlives {
+		r2 := *req
+		r2.Headers = cloneHeaders(req.Headers)
+		r2.Headers.Set("Connection", "close")
+		req = &r2
+	}
+	connection, _ := req.Headers.Get("Connection")
+	keepAlive := !hasToken(connection, "close")
+
+	reuse := !c.DisableKeepAlives
+	for {
+		pc, err := c.pool.get(ctx, connKey(req.URL), c.MaxConnsPerHost, reuse, func() (net.Conn, error) {
+			return c.dial(ctx, req)
+		})
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		res, err := c.exchange(ctx, cancel, pc, req, keepAlive)
+		if err == nil {
+			return res, nil
+		}
+		if pc.reused && retryable(req, err) && ctx.Err() == nil {
+			// The server closed the pooled connection before reading the
+			// request, so a fresh connection is safe for idempotent methods.
+			reuse = false
+			continue
+		}
+		cancel()
+		return nil, contextError(ctx, err)
+	}
+}
+
+func (c *Client) exchange(ctx context.Context, cancel context.CancelFunc, pc *persistConn, req *Request, keepAlive bool) (*Response, error) {
+	stop := context.AfterFunc(ctx, func() { pc.conn.SetDeadline(time.Unix(1, 0)) })
+	if err := req.Write(pc.conn); err != nil {
+		stop()
+		c.pool.discard(pc)
+		return nil, err
+	}
+	res, err := ReadResponse(pc.br, req.Method)
+	if err != nil {
+		stop()
+		c.pool.discard(pc)
+		return nil, err
+	}
+
+	reusable := keepAlive && !res.Close && res.StatusCode != 101
+	var once sync.Once
+	release := func(eof bool) {
+		once.Do(func() {
+			if stop() && eof && reusable {
+				pc.conn.SetDeadline(time.Time{})
+				c.pool.put(pc, c.MaxIdleConns, c.maxIdlePerHost(), c.idleTimeout())
+			} else {
+				c.pool.discard(pc)
+			}
+			cancel()
+		})
+	}
+	empty := res.ContentLength == 0 && !res.Chunked || req.Method == "HEAD" || res.StatusCode == 204 || res.StatusCode == 304
+	res.Body = &connBody{r: res.Body, ctx: ctx, empty: empty, release: release}
+	return res, nil
+}
+
+func (c *Client) CloseIdleConnections() {
+	c.pool.closeIdle()
+}
+
+func (c *Client) maxIdlePerHost() int {
+	if c.MaxIdleConnsPerHost > 0 {
+		return c.MaxIdleConnsPerHost
+	}
+	return defaultMaxIdleConnsPerHost
+}
+
+func (c *Client) idleTimeout() time.Duration {
+	if c.IdleConnTimeout > 0 {
+		return c.IdleConnTimeout
+	}
+	return defaultIdleConnTimeout
+}
+
+func connKey(u *url.URL) string {
+	return u.Scheme + "://" + hostPort(u.Scheme, u.Host)
+}
+
+func retryable(req *Request, err error) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+	default:
+		return false
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+func (c *Client) dial(ctx context.Context, req *Request) (net.Conn, error) {
+	addr := hostPort(req.URL.Scheme, req.URL.Host)
+	dialTimeout := c.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, contextError(ctx, fmt.Errorf("dialing %s: %w", addr, err))
+	}
+	if req.URL.Scheme != "https" {
+		return c.wrap(conn), nil
+	}
+
+	cfg := &tls.Config{}
+	if c.TLSConfig != nil {
+		cfg = c.TLSConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = req.URL.Hostname()
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, contextError(ctx, fmt.Errorf("tls handshake with %s: %w", addr, err))
+	}
+	return c.wrap(tlsConn), nil
+}
+
+func (c *Client) wrap(conn net.Conn) net.Conn {
+	if c.WrapConn == nil {
+		return conn
+	}
+	return c.WrapConn(conn)
+}
+
+func hostPort(scheme, host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if scheme == "https" {
+		return net.JoinHostPort(host, "443")
+	}
+	return net.JoinHostPort(host, "80")
+}
+
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %s", context.Cause(ctx), err.Error())
+	}
+	return err
+}
+
+type connBody struct {
+	r       io.ReadCloser
+	ctx     context.Context
+	empty   bool
+	release func(eof bool)
+}
+
+func (b *connBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		b.release(true)
+	} else if err != nil {
+		b.release(false)
+		err = contextError(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *connBody) Close() error {
+	b.release(b.empty)
+	return nil
+}
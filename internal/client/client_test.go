@@ -0,0 +1,156 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler server.Handler) string {
+	t.Helper()
+	srv, err := server.Serve(0, handler)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return fmt.Sprintf("http://127.0.0.1:%d", srv.Addr().(*net.TCPAddr).Port)
+}
+
+func TestWriteRequest(t *testing.T) {
+	req, err := NewRequest("POST", "http://example.com:8080/items?x=1", []byte("hello"))
+	require.NoError(t, err)
+	req.Headers.Set("X-Custom", "yes")
+
+	var out strings.Builder
+	require.NoError(t, req.Write(&out))
+	rq, err := request.RequestFromReader(strings.NewReader(out.String()))
+	require.NoError(t, err)
+	assert.Equal(t, "POST", rq.RequestLine.Method)
+	assert.Equal(t, "/items?x=1", rq.RequestLine.RequestTarget)
+	host, _ := rq.Headers.Get("Host")
+	assert.Equal(t, "example.com:8080", host)
+	custom, _ := rq.Headers.Get("X-Custom")
+	assert.Equal(t, "yes", custom)
+	assert.Equal(t, "hello", string(rq.Body))
+
+	_, err = NewRequest("GET", "ftp://example.com/", nil)
+	assert.Error(t, err)
+}
+
+func TestDoAgainstOwnServer(t *testing.T) {
+	url := startServer(t, func(w *response.Writer, r *request.Request) {
+		body := r.RequestLine.Method + " " + r.RequestLine.RequestTarget + " " + string(r.Body)
+		w.WriteStatusLine(response.OkStatus)
+		hdrs := response.GetDefaultHeaders(0)
+		hdrs.Remove("Content-Length")
+		hdrs.Set("Transfer-Encoding", "chunked")
+		w.WriteHeaders(hdrs)
+		w.WriteChunkedBody([]byte(body))
+		w.WriteChunkedBodyDone()
+	})
+
+	req, err := NewRequest("PUT", url+"/thing?id=7", []byte("payload"))
+	require.NoError(t, err)
+	res, err := (&Client{Timeout: 5 * time.Second}).Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, response.OkStatus, res.StatusCode)
+	assert.True(t, res.Chunked)
+	assert.Equal(t, "PUT /thing?id=7 payload", string(body))
+}
+
+func TestDoOverTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure "+r.Host)
+	}))
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	c := &Client{TLSConfig: &tls.Config{RootCAs: roots, ServerName: "example.com"}}
+
+	req, err := NewRequest("GET", strings.Replace(srv.URL, "127.0.0.1", "localhost", 1), nil)
+	require.NoError(t, err)
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(body), "secure localhost:"))
+}
+
+func TestDoHonoursContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadString('\n')
+		time.Sleep(time.Second)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := NewRequest("GET", "http://"+listener.Addr().String()+"/", nil)
+	require.NoError(t, err)
+	_, err = DefaultClient.Do(req.WithContext(ctx))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+type recordingConn struct {
+	net.Conn
+	sent, received *strings.Builder
+}
+
+func (c recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.Write(p[:n])
+	return n, err
+}
+
+func (c recordingConn) Write(p []byte) (int, error) {
+	c.sent.Write(p)
+	return c.Conn.Write(p)
+}
+
+func TestWrapConnSeesRawBytes(t *testing.T) {
+	url := startServer(t, func(w *response.Writer, r *request.Request) {
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		w.WriteBody([]byte("ok"))
+	})
+
+	var sent, received strings.Builder
+	c := &Client{WrapConn: func(conn net.Conn) net.Conn {
+		return recordingConn{Conn: conn, sent: &sent, received: &received}
+	}}
+	req, err := NewRequest("GET", url+"/raw", nil)
+	require.NoError(t, err)
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	res.Body.Close()
+
+	assert.True(t, strings.HasPrefix(sent.String(), "GET /raw HTTP/1.1\r\n"))
+	assert.True(t, strings.HasPrefix(received.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(received.String(), "\r\n\r\nok"))
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/cookie"
+)
+
+type jarEntry struct {
+	cookie   cookie.Cookie
+	hostOnly bool
+	expires  time.Time
+	created  time.Time
+}
+
+// Jar is an in-memory cookie store. It does not consult the public suffix
+// list, so a server may set cookies for any parent domain of its host.
+type Jar struct {
+	mu      sync.Mutex
+	entries map[string]*jarEntry
+	now     func() time.Time
+}
+
+func NewJar() *Jar {
+	return &Jar{
+		entries: make(map[string]*jarEntry),
+		now:     time.Now,
+	}
+}
+
+func (j *Jar) SetCookies(u *url.URL, lines []string) {
+	host := canonicalHost(u.Hostname())
+	now := j.now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, line := range lines {
+		c, err := cookie.ParseSetCookie(line)
+		if err != nil {
+			continue
+		}
+		if c.Secure && u.Scheme != "https" {
+			continue
+		}
+
+		e := &jarEntry{cookie: *c, hostOnly: true, created: now}
+		if c.Domain == "" {
+			e.cookie.Domain = host
+		} else {
+			domain := canonicalHost(c.Domain)
+			if !domainMatch(host, domain) || (net.ParseIP(host) != nil && host != domain) {
+				continue
+			}
+			e.cookie.Domain = domain
+			e.hostOnly = false
+		}
+		if !strings.HasPrefix(c.Path, "/") {
+			e.cookie.Path = defaultPath(u.Path)
+		}
+
+		key := e.cookie.Domain + ";" + e.cookie.Path + ";" + e.cookie.Name
+		switch {
+		case c.MaxAge < 0:
+			delete(j.entries, key)
+			continue
+		case c.MaxAge > 0:
+			e.expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			if !c.Expires.After(now) {
+				delete(j.entries, key)
+				continue
+			}
+			e.expires = c.Expires
+		}
+		if old, ok := j.entries[key]; ok {
+			e.created = old.created
+		}
+		j.entries[key] = e
+	}
+}
+
+func (j *Jar) Cookies(u *url.URL) []*cookie.Cookie {
+	host := canonicalHost(u.Hostname())
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	now := j.now()
+
+	j.mu.Lock()
+	var matches []*jarEntry
+	for key, e := range j.entries {
+		if !e.expires.IsZero() && !e.expires.After(now) {
+			delete(j.entries, key)
+			continue
+		}
+		if e.hostOnly && host != e.cookie.Domain || !e.hostOnly && !domainMatch(host, e.cookie.Domain) {
+			continue
+		}
+		if !pathMatch(path, e.cookie.Path) || e.cookie.Secure && u.Scheme != "https" {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	j.mu.Unlock()
+
+	sort.Slice(matches, func(a, b int) bool {
+		if len(matches[a].cookie.Path) != len(matches[b].cookie.Path) {
+			return len(matches[a].cookie.Path) > len(matches[b].cookie.Path)
+		}
+		return matches[a].created.Before(matches[b].created)
+	})
+	cookies := make([]*cookie.Cookie, 0, len(matches))
+	for _, e := range matches {
+		cookies = append(cookies, &cookie.Cookie{Name: e.cookie.Name, Value: e.cookie.Value})
+	}
+	return cookies
+}
+
+func canonicalHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+func defaultPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
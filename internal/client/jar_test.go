@@ -0,0 +1,85 @@
+package client
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/cookie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	return u
+}
+
+func names(cookies []*cookie.Cookie) []string {
+	var out []string
+	for _, c := range cookies {
+		out = append(out, c.Name+"="+c.Value)
+	}
+	return out
+}
+
+func TestJarDomainMatching(t *testing.T) {
+	jar := NewJar()
+	jar.SetCookies(mustURL(t, "http://www.example.com/"), []string{
+		"host=1",
+		"wide=2; Domain=example.com",
+		"foreign=3; Domain=other.com",
+		"sub=4; Domain=api.example.com",
+	})
+
+	assert.ElementsMatch(t, []string{"host=1", "wide=2"}, names(jar.Cookies(mustURL(t, "http://www.example.com/"))))
+	assert.Equal(t, []string{"wide=2"}, names(jar.Cookies(mustURL(t, "http://api.example.com/"))))
+	assert.Equal(t, []string{"wide=2"}, names(jar.Cookies(mustURL(t, "http://example.com/"))))
+	assert.Empty(t, jar.Cookies(mustURL(t, "http://notexample.com/")))
+}
+
+func TestJarPathMatching(t *testing.T) {
+	jar := NewJar()
+	jar.SetCookies(mustURL(t, "http://example.com/docs/guide/intro"), []string{
+		"implicit=1",
+		"root=2; Path=/",
+		"docs=3; Path=/docs",
+	})
+
+	assert.Equal(t, []string{"implicit=1", "docs=3", "root=2"}, names(jar.Cookies(mustURL(t, "http://example.com/docs/guide/next"))))
+	assert.Equal(t, []string{"docs=3", "root=2"}, names(jar.Cookies(mustURL(t, "http://example.com/docs"))))
+	assert.Equal(t, []string{"root=2"}, names(jar.Cookies(mustURL(t, "http://example.com/docsify"))))
+}
+
+func TestJarSecureCookies(t *testing.T) {
+	jar := NewJar()
+	jar.SetCookies(mustURL(t, "http://example.com/"), []string{"insecure-origin=1; Secure"})
+	jar.SetCookies(mustURL(t, "https://example.com/"), []string{"secure=2; Secure"})
+
+	assert.Empty(t, jar.Cookies(mustURL(t, "http://example.com/")))
+	assert.Equal(t, []string{"secure=2"}, names(jar.Cookies(mustURL(t, "https://example.com/"))))
+}
+
+func TestJarExpiry(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	jar := NewJar()
+	jar.now = func() time.Time { return now }
+	u := mustURL(t, "http://example.com/")
+
+	jar.SetCookies(u, []string{
+		"short=1; Max-Age=60",
+		"dated=2; Expires=Fri, 02 Jan 2026 00:00:00 GMT",
+		"stale=3; Expires=Wed, 31 Dec 2025 00:00:00 GMT",
+		"session=4",
+	})
+	assert.ElementsMatch(t, []string{"short=1", "dated=2", "session=4"}, names(jar.Cookies(u)))
+
+	now = now.Add(2 * time.Minute)
+	assert.ElementsMatch(t, []string{"dated=2", "session=4"}, names(jar.Cookies(u)))
+
+	jar.SetCookies(u, []string{"session=; Max-Age=0"})
+	now = now.Add(48 * time.Hour)
+	assert.Empty(t, jar.Cookies(u))
+}
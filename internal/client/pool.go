@@ -0,0 +1,186 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 2
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+type persistConn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	key       string
+	reused    bool
+	idleTimer *time.Timer
+	watchDone chan struct{}
+	broken    atomic.Bool
+}
+
+// watch blocks on the idle connection so a close or stray bytes from the
+// server mark it broken before it is handed out again.
+func (pc *persistConn) watch(p *connPool) {
+	pc.watchDone = make(chan struct{})
+	go func() {
+		defer close(pc.watchDone)
+		_, err := pc.br.Peek(1)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return
+		}
+		pc.broken.Store(true)
+		p.removeIdle(pc)
+	}()
+}
+
+func (pc *persistConn) stopWatch() bool {
+	pc.conn.SetReadDeadline(time.Unix(1, 0))
+	<-pc.watchDone
+	pc.conn.SetReadDeadline(time.Time{})
+	return !pc.broken.Load()
+}
+
+type connPool struct {
+	mu        sync.Mutex
+	idle      map[string][]*persistConn
+	idleCount int
+	open      map[string]int
+	wake      map[string]chan struct{}
+}
+
+func (p *connPool) init() {
+	if p.idle == nil {
+		p.idle = make(map[string][]*persistConn)
+		p.open = make(map[string]int)
+		p.wake = make(map[string]chan struct{})
+	}
+}
+
+func (p *connPool) get(ctx context.Context, key string, maxPerHost int, reuse bool, dial func() (net.Conn, error)) (*persistConn, error) {
+	for {
+		p.mu.Lock()
+		p.init()
+		if reuse {
+			if pc := p.popIdle(key); pc != nil {
+				p.mu.Unlock()
+				if pc.stopWatch() {
+					pc.reused = true
+					return pc, nil
+				}
+				p.discard(pc)
+				continue
+			}
+		}
+		if maxPerHost <= 0 || p.open[key] < maxPerHost {
+			p.open[key]++
+			p.mu.Unlock()
+			conn, err := dial()
+			if err != nil {
+				p.mu.Lock()
+				p.release(key)
+				p.mu.Unlock()
+				return nil, err
+			}
+			return &persistConn{conn: conn, br: bufio.NewReader(conn), key: key}, nil
+		}
+		wake, ok := p.wake[key]
+		if !ok {
+			wake = make(chan struct{})
+			p.wake[key] = wake
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+}
+
+func (p *connPool) put(pc *persistConn, maxIdle, maxIdlePerHost int, idleTimeout time.Duration) {
+	p.mu.Lock()
+	p.init()
+	if len(p.idle[pc.key]) >= maxIdlePerHost || (maxIdle > 0 && p.idleCount >= maxIdle) {
+		p.mu.Unlock()
+		p.discard(pc)
+		return
+	}
+	p.idle[pc.key] = append(p.idle[pc.key], pc)
+	p.idleCount++
+	pc.idleTimer = time.AfterFunc(idleTimeout, func() { p.removeIdle(pc) })
+	pc.watch(p)
+	p.notify(pc.key)
+	p.mu.Unlock()
+}
+
+func (p *connPool) popIdle(key string) *persistConn {
+	conns := p.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	pc := conns[len(conns)-1]
+	p.idle[key] = conns[:len(conns)-1]
+	p.idleCount--
+	pc.idleTimer.Stop()
+	return pc
+}
+
+func (p *connPool) removeIdle(pc *persistConn) {
+	p.mu.Lock()
+	conns := p.idle[pc.key]
+	for i, c := range conns {
+		if c == pc {
+			p.idle[pc.key] = append(conns[:i], conns[i+1:]...)
+			p.idleCount--
+			pc.idleTimer.Stop()
+			p.release(pc.key)
+			p.mu.Unlock()
+			pc.conn.Close()
+			return
+		}
+	}
+	p.mu.Unlock()
+}
+
+func (p *connPool) discard(pc *persistConn) {
+	pc.conn.Close()
+	p.mu.Lock()
+	p.release(pc.key)
+	p.mu.Unlock()
+}
+
+func (p *connPool) release(key string) {
+	p.open[key]--
+	if p.open[key] <= 0 {
+		delete(p.open, key)
+	}
+	p.notify(key)
+}
+
+func (p *connPool) notify(key string) {
+	if wake, ok := p.wake[key]; ok {
+		close(wake)
+		delete(p.wake, key)
+	}
+}
+
+func (p *connPool) closeIdle() {
+	p.mu.Lock()
+	var conns []*persistConn
+	for _, idle := range p.idle {
+		conns = append(conns, idle...)
+	}
+	p.mu.Unlock()
+	for _, pc := range conns {
+		p.removeIdle(pc)
+	}
+}
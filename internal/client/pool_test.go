@@ -0,0 +1,194 @@
+package client
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+func get(t *testing.T, c *Client, url string) string {
+	t.Helper()
+	req, err := NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestKeepAliveReusesConnection(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	})
+	c := &Client{}
+	for range 5 {
+		assert.Equal(t, "pong", get(t, c, srv.URL+"/ping"))
+	}
+	assert.Equal(t, int64(1), conns.Load())
+
+	c.DisableKeepAlives = true
+	get(t, c, srv.URL)
+	get(t, c, srv.URL)
+	assert.Equal(t, int64(3), conns.Load())
+
+	// The caller's request must not pick up Connection: close.
+	req, err := NewRequest("GET", srv.URL, nil)
+	require.NoError(t, err)
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	_, ok := req.Headers.Get("Connection")
+	assert.False(t, ok)
+}
+
+func TestEmptyBodyCloseKeepsConnection(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	c := &Client{}
+	for range 3 {
+		req, err := NewRequest("GET", srv.URL, nil)
+		require.NoError(t, err)
+		res, err := c.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+	assert.Equal(t, int64(1), conns.Load())
+}
+
+func TestIdleTimeoutClosesConnections(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	})
+	c := &Client{IdleConnTimeout: 20 * time.Millisecond}
+	get(t, c, srv.URL)
+	time.Sleep(100 * time.Millisecond)
+	get(t, c, srv.URL)
+	assert.Equal(t, int64(2), conns.Load())
+}
+
+func TestMaxIdleConnsPerHost(t *testing.T) {
+	release := make(chan struct{})
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "pong")
+	})
+	c := &Client{MaxIdleConnsPerHost: 1}
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(t, c, srv.URL)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(3), conns.Load())
+
+	get(t, c, srv.URL)
+	get(t, c, srv.URL)
+	assert.Equal(t, int64(3), conns.Load())
+}
+
+func TestMaxConnsPerHostWaitsForIdleConnection(t *testing.T) {
+	var inFlight, peak atomic.Int64
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+		io.WriteString(w, "pong")
+	})
+	c := &Client{MaxConnsPerHost: 2}
+
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(t, c, srv.URL)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, peak.Load(), int64(2))
+	assert.LessOrEqual(t, conns.Load(), int64(2))
+}
+
+func TestRetryOnServerClosedConnection(t *testing.T) {
+	var requests atomic.Int64
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.WriteString(w, "pong")
+	})
+	c := &Client{}
+	get(t, c, srv.URL)
+
+	// Drop the pooled connection from the server side while the watcher is
+	// not looking, the way a keep-alive timeout races a new request.
+	c.pool.mu.Lock()
+	var pc *persistConn
+	for _, idle := range c.pool.idle {
+		pc = idle[0]
+	}
+	c.pool.mu.Unlock()
+	require.NotNil(t, pc)
+	pc.stopWatch()
+	srv.CloseClientConnections()
+	time.Sleep(20 * time.Millisecond)
+	pc.broken.Store(false)
+	pc.watchDone = make(chan struct{})
+	close(pc.watchDone)
+
+	assert.Equal(t, "pong", get(t, c, srv.URL))
+	assert.Equal(t, int64(2), conns.Load())
+	assert.Equal(t, int64(2), requests.Load())
+}
+
+func TestWatcherDropsServerClosedConnection(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	})
+	c := &Client{}
+	get(t, c, srv.URL)
+	srv.CloseClientConnections()
+	time.Sleep(20 * time.Millisecond)
+
+	c.pool.mu.Lock()
+	idle := c.pool.idleCount
+	c.pool.mu.Unlock()
+	assert.Equal(t, 0, idle)
+	get(t, c, srv.URL)
+	assert.Equal(t, int64(2), conns.Load())
+}
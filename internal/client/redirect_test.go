@@ -0,0 +1,144 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type seenRequest struct {
+	method, path, body, auth, cookie string
+}
+
+func recordingServer(t *testing.T, redirects map[string]string, codes map[string]int) (*httptest.Server, *[]seenRequest) {
+	t.Helper()
+	var seen []seenRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = append(seen, seenRequest{r.Method, r.URL.Path, string(body), r.Header.Get("Authorization"), r.Header.Get("Cookie")})
+		if target, ok := redirects[r.URL.Path]; ok {
+			w.Header().Set("Location", target)
+			w.WriteHeader(codes[r.URL.Path])
+			return
+		}
+		io.WriteString(w, "final "+r.Method)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &seen
+}
+
+func do(t *testing.T, c *Client, method, url, body string) (*Response, string, error) {
+	t.Helper()
+	req, err := NewRequest(method, url, []byte(body))
+	require.NoError(t, err)
+	req.Headers.Set("Content-Type", "text/plain")
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(data), nil
+}
+
+func TestRedirectMethodRewriting(t *testing.T) {
+	srv, seen := recordingServer(t,
+		map[string]string{"/301": "/done", "/302": "/done", "/303": "/done", "/307": "/done", "/308": "/done"},
+		map[string]int{"/301": 301, "/302": 302, "/303": 303, "/307": 307, "/308": 308})
+	c := &Client{FollowRedirects: true}
+
+	cases := []struct {
+		path, method, body string
+	}{
+		{"/301", "GET", ""},
+		{"/302", "GET", ""},
+		{"/303", "GET", ""},
+		{"/307", "POST", "payload"},
+		{"/308", "POST", "payload"},
+	}
+	for _, tc := range cases {
+		*seen = nil
+		res, body, err := do(t, c, "POST", srv.URL+tc.path, "payload")
+		require.NoError(t, err)
+		assert.Equal(t, response.OkStatus, res.StatusCode)
+		assert.Equal(t, "final "+tc.method, body, tc.path)
+		require.Len(t, *seen, 2)
+		assert.Equal(t, tc.body, (*seen)[1].body, tc.path)
+		assert.Equal(t, "/done", res.Request.URL.Path)
+	}
+
+	*seen = nil
+	_, body, err := do(t, c, "PUT", srv.URL+"/303", "payload")
+	require.NoError(t, err)
+	assert.Equal(t, "final GET", body)
+}
+
+func TestRedirectNotFollowedByDefault(t *testing.T) {
+	srv, _ := recordingServer(t, map[string]string{"/a": "/b"}, map[string]int{"/a": 302})
+	res, _, err := do(t, &Client{}, "GET", srv.URL+"/a", "")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(302), res.StatusCode)
+	location, _ := res.Headers.Get("Location")
+	assert.Equal(t, "/b", location)
+}
+
+func TestRedirectLimit(t *testing.T) {
+	srv, seen := recordingServer(t, map[string]string{"/loop": "/loop"}, map[string]int{"/loop": 302})
+	_, _, err := do(t, &Client{FollowRedirects: true, MaxRedirects: 3}, "GET", srv.URL+"/loop", "")
+	assert.True(t, errors.Is(err, ErrTooManyRedirects))
+	assert.Len(t, *seen, 4)
+}
+
+func TestCrossHostRedirectStripsAuthorization(t *testing.T) {
+	other, otherSeen := recordingServer(t, nil, nil)
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	srv, seen := recordingServer(t,
+		map[string]string{"/same": "/landing", "/away": otherURL + "/landing"},
+		map[string]int{"/same": 302, "/away": 302})
+	c := &Client{FollowRedirects: true}
+
+	for _, path := range []string{"/same", "/away"} {
+		req, err := NewRequest("GET", srv.URL+path, nil)
+		require.NoError(t, err)
+		req.Headers.Set("Authorization", "Bearer secret")
+		res, err := c.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+	require.Len(t, *seen, 3)
+	assert.Equal(t, "Bearer secret", (*seen)[1].auth)
+	require.Len(t, *otherSeen, 1)
+	assert.Empty(t, (*otherSeen)[0].auth)
+}
+
+func TestJarAcrossRedirects(t *testing.T) {
+	var cookies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies = append(cookies, r.Header.Get("Cookie"))
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Add("Set-Cookie", "session=abc; Path=/; HttpOnly")
+			w.Header().Add("Set-Cookie", "scoped=1; Path=/admin")
+			w.Header().Set("Location", "/home")
+			w.WriteHeader(http.StatusSeeOther)
+		case "/logout":
+			w.Header().Add("Set-Cookie", "session=; Max-Age=0; Path=/")
+		}
+	}))
+	defer srv.Close()
+	c := &Client{FollowRedirects: true, Jar: NewJar()}
+
+	for _, path := range []string{"/login", "/admin/panel", "/logout", "/home"} {
+		_, _, err := do(t, c, "GET", srv.URL+path, "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"", "session=abc", "scoped=1; session=abc", "session=abc", ""}, cookies)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+)
+
+type Request struct {
+	Method  string
+	URL     *url.URL
+	Headers headers.Headers
+	Body    []byte
+	ctx     context.Context
+}
+
+func NewRequest(method, rawURL string, body []byte) (*Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request url: %s", err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in request url: %s", rawURL)
+	}
+	if method == "" {
+		method = "GET"
+	}
+	return &Request{
+		Method:  method,
+		URL:     u,
+		Headers: headers.NewHeaders(),
+		Body:    body,
+	}, nil
+}
+
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+func (r *Request) Host() string {
+	if host, ok := r.Headers.Get("Host"); ok && host != "" {
+		return host
+	}
+	return r.URL.Host
+}
+
+func (r *Request) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s HTTP/1.1\r\n", r.Method, r.URL.RequestURI())
+	fmt.Fprintf(bw, "Host: %s\r\n", r.Host())
+
+	for key, val := range r.Headers {
+		switch strings.ToLower(key) {
+		case "host", "content-length", "transfer-encoding":
+			continue
+		}
+		if strings.ContainsAny(key+val, "\r\n") {
+			return fmt.Errorf("invalid header %q", key)
+		}
+		fmt.Fprintf(bw, "%s: %s\r\n", key, val)
+	}
+	if len(r.Body) > 0 || bodyExpected(r.Method) {
+		fmt.Fprintf(bw, "Content-Length: %s\r\n", strconv.Itoa(len(r.Body)))
+	}
+	bw.WriteString("\r\n")
+	bw.Write(r.Body)
+	return bw.Flush()
+}
+
+func bodyExpected(method string) bool {
+	switch method {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/response"
+)
+
+const (
+	maxHeaderBytes    = 1 << 20
+	maxChunkLineBytes = 4096
+)
+
+var ErrMalformedResponse = errors.New("malformed http response")
+
+type Response struct {
+	Proto      string
+	StatusCode response.StatusCode
+	Reason     string
+	Headers    headers.Headers
+	// SetCookies keeps every Set-Cookie field line on its own, since
+	// Headers joins repeated fields with commas.
+	SetCookies    []string
+	Informational []*Response
+	ContentLength int64
+	Chunked       bool
+	Close         bool
+	Trailers      headers.Headers
+	Body          io.ReadCloser
+	Request       *Request
+}
+
+func ReadResponse(br *bufio.Reader, method string) (*Response, error) {
+	var informational []*Response
+	for {
+		res, err := readHead(br)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode >= 100 && res.StatusCode < 200 && res.StatusCode != response.SwitchingProtocolsStatus {
+			res.Body = io.NopCloser(bytes.NewReader(nil))
+			informational = append(informational, res)
+			continue
+		}
+		res.Informational = informational
+		if err := res.setupBody(br, method); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+func readHead(br *bufio.Reader) (*Response, error) {
+	line, err := readLine(br, maxHeaderBytes)
+	if err != nil {
+		return nil, err
+	}
+	proto, rest, _ := strings.Cut(line, " ")
+	codeText, reason, _ := strings.Cut(rest, " ")
+	if proto != "HTTP/1.1" && proto != "HTTP/1.0" {
+		return nil, fmt.Errorf("%w: unsupported protocol in status line %q", ErrMalformedResponse, line)
+	}
+	code, err := strconv.Atoi(codeText)
+	if err != nil || len(codeText) != 3 || code < 100 {
+		return nil, fmt.Errorf("%w: invalid status code in status line %q", ErrMalformedResponse, line)
+	}
+
+	res := &Response{
+		Proto:         proto,
+		StatusCode:    response.StatusCode(code),
+		Reason:        reason,
+		Headers:       headers.NewHeaders(),
+		ContentLength: -1,
+	}
+	read := len(line)
+	for {
+		line, err := readLine(br, maxHeaderBytes-read)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		read += len(line)
+		if line == "" {
+			return res, nil
+		}
+		if strings.HasPrefix(line, ":") || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("%w: bad header line %q", ErrMalformedResponse, line)
+		}
+		if name, val, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Set-Cookie") {
+			res.SetCookies = append(res.SetCookies, strings.TrimSpace(val))
+		}
+		if _, _, err := res.Headers.Parse([]byte(line + "\r\n")); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMalformedResponse, err.Error())
+		}
+	}
+}
+
+func (res *Response) setupBody(br *bufio.Reader, method string) error {
+	connection, _ := res.Headers.Get("Connection")
+	res.Close = hasToken(connection, "close") || (res.Proto == "HTTP/1.0" && !hasToken(connection, "keep-alive"))
+
+	if method == "HEAD" || res.StatusCode == 204 || res.StatusCode == 304 || res.StatusCode == response.SwitchingProtocolsStatus {
+		if cl, ok := res.Headers.Get("Content-Length"); ok {
+			res.ContentLength, _ = strconv.ParseInt(cl, 10, 64)
+		}
+		res.Body = io.NopCloser(bytes.NewReader(nil))
+		return nil
+	}
+
+	if te, ok := res.Headers.Get("Transfer-Encoding"); ok {
+		codings := strings.Split(te, ",")
+		if !strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			res.Close = true
+			res.Body = io.NopCloser(br)
+			return nil
+		}
+		res.Chunked = true
+		res.Body = io.NopCloser(&chunkedReader{br: br, res: res})
+		return nil
+	}
+
+	if cl, ok := res.Headers.Get("Content-Length"); ok {
+		n, err := parseContentLength(cl)
+		if err != nil {
+			return err
+		}
+		res.ContentLength = n
+		res.Body = io.NopCloser(&lengthReader{r: br, remaining: n})
+		return nil
+	}
+
+	res.Close = true
+	res.Body = io.NopCloser(br)
+	return nil
+}
+
+func parseContentLength(cl string) (int64, error) {
+	var n int64 = -1
+	for _, part := range strings.Split(cl, ",") {
+		v, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || v < 0 || (n != -1 && v != n) {
+			return 0, fmt.Errorf("%w: invalid content length %q", ErrMalformedResponse, cl)
+		}
+		n = v
+	}
+	return n, nil
+}
+
+type lengthReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (lr *lengthReader) Read(p []byte) (int, error) {
+	if lr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > lr.remaining {
+		p = p[:lr.remaining]
+	}
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	if errors.Is(err, io.EOF) && lr.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	if lr.remaining == 0 && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+type chunkedReader struct {
+	br        *bufio.Reader
+	res       *Response
+	remaining int64
+	done      bool
+	err       error
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	if cr.done {
+		return 0, io.EOF
+	}
+	if cr.remaining == 0 {
+		size, err := cr.readChunkSize()
+		if err != nil {
+			cr.err = err
+			return 0, err
+		}
+		if size == 0 {
+			if err := cr.readTrailers(); err != nil {
+				cr.err = err
+				return 0, err
+			}
+			cr.done = true
+			return 0, io.EOF
+		}
+		cr.remaining = size
+	}
+
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.br.Read(p)
+	cr.remaining -= int64(n)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		cr.err = err
+		return n, err
+	}
+	if cr.remaining == 0 {
+		if err := expectCRLF(cr.br); err != nil {
+			cr.err = err
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (cr *chunkedReader) readChunkSize() (int64, error) {
+	line, err := readLine(cr.br, maxChunkLineBytes)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	sizeText, _, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeText), 16, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedResponse, line)
+	}
+	return size, nil
+}
+
+func (cr *chunkedReader) readTrailers() error {
+	read := 0
+	for {
+		line, err := readLine(cr.br, maxHeaderBytes-read)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		read += len(line)
+		if line == "" {
+			return nil
+		}
+		if cr.res.Trailers == nil {
+			cr.res.Trailers = headers.NewHeaders()
+		}
+		if _, _, err := cr.res.Trailers.Parse([]byte(line + "\r\n")); err != nil {
+			return fmt.Errorf("%w: %s", ErrMalformedResponse, err.Error())
+		}
+	}
+}
+
+func readLine(br *bufio.Reader, limit int) (string, error) {
+	var line []byte
+	for {
+		frag, err := br.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(line) > limit {
+			return "", fmt.Errorf("%w: header section too large", ErrMalformedResponse)
+		}
+		if err == nil {
+			break
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "", fmt.Errorf("%w: line not terminated by CRLF", ErrMalformedResponse)
+	}
+	return string(line[:len(line)-2]), nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func expectCRLF(br *bufio.Reader) error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(br, crlf[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return fmt.Errorf("%w: missing CRLF after chunk data", ErrMalformedResponse)
+	}
+	return nil
+}
+
+func hasToken(header, token string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
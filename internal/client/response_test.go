@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readResponse(t *testing.T, raw, method string) (*Response, string, error) {
+	t.Helper()
+	res, err := ReadResponse(bufio.NewReader(strings.NewReader(raw)), method)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(res.Body)
+	return res, string(body), err
+}
+
+func TestContentLengthBody(t *testing.T) {
+	res, body, err := readResponse(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhelloEXTRA", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.OkStatus, res.StatusCode)
+	assert.Equal(t, "OK", res.Reason)
+	assert.Equal(t, int64(5), res.ContentLength)
+	assert.Equal(t, "hello", body)
+	ctype, _ := res.Headers.Get("Content-Type")
+	assert.Equal(t, "text/plain", ctype)
+	assert.False(t, res.Close)
+}
+
+func TestShortContentLengthBody(t *testing.T) {
+	_, _, err := readResponse(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nhello", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestChunkedBodyWithTrailers(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Checksum\r\n\r\n" +
+		"5;ext=1\r\nhello\r\n7\r\n, world\r\n0\r\nX-Checksum: abc\r\n\r\n"
+	res, body, err := readResponse(t, raw, "GET")
+	require.NoError(t, err)
+	assert.True(t, res.Chunked)
+	assert.Equal(t, "hello, world", body)
+	sum, ok := res.Trailers.Get("X-Checksum")
+	require.True(t, ok)
+	assert.Equal(t, "abc", sum)
+}
+
+func TestMalformedChunkedBody(t *testing.T) {
+	_, _, err := readResponse(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n", "GET")
+	assert.True(t, errors.Is(err, ErrMalformedResponse))
+
+	_, _, err = readResponse(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhelloXX0\r\n\r\n", "GET")
+	assert.True(t, errors.Is(err, ErrMalformedResponse))
+
+	_, _, err = readResponse(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestCloseDelimitedBody(t *testing.T) {
+	res, body, err := readResponse(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil the end", "GET")
+	require.NoError(t, err)
+	assert.True(t, res.Close)
+	assert.Equal(t, int64(-1), res.ContentLength)
+	assert.Equal(t, "until the end", body)
+}
+
+func TestInformationalResponses(t *testing.T) {
+	raw := "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n" +
+		"HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok"
+	res, body, err := readResponse(t, raw, "POST")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(201), res.StatusCode)
+	assert.Equal(t, "ok", body)
+	require.Len(t, res.Informational, 2)
+	assert.Equal(t, response.StatusCode(100), res.Informational[0].StatusCode)
+	link, _ := res.Informational[1].Headers.Get("Link")
+	assert.Equal(t, "</style.css>; rel=preload", link)
+}
+
+func TestResponsesWithoutBody(t *testing.T) {
+	res, body, err := readResponse(t, "HTTP/1.1 200 OK\r\nContent-Length: 1234\r\n\r\n", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), res.ContentLength)
+	assert.Empty(t, body)
+
+	_, body, err = readResponse(t, "HTTP/1.1 304 Not Modified\r\nETag: \"x\"\r\n\r\nHTTP/1.1 200 OK", "GET")
+	require.NoError(t, err)
+	assert.Empty(t, body)
+}
+
+func TestSetCookiesKeptSeparate(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nSet-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: b=2\r\nContent-Length: 0\r\n\r\n"
+	res, _, err := readResponse(t, raw, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2"}, res.SetCookies)
+}
+
+func TestMalformedStatusLines(t *testing.T) {
+	for _, raw := range []string{
+		"HTTP/2 200 OK\r\n\r\n",
+		"HTTP/1.1 20 OK\r\n\r\n",
+		"HTTP/1.1 abc OK\r\n\r\n",
+		"HTTP/1.1 200 OK\nContent-Length: 0\n\n",
+		"HTTP/1.1 200 OK\r\nBad Header: x\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 1, 2\r\n\r\n",
+	} {
+		_, _, err := readResponse(t, raw, "GET")
+		assert.True(t, errors.Is(err, ErrMalformedResponse), raw)
+	}
+	_, _, err := readResponse(t, "HTTP/1.1 200 OK\r\nContent-Le", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,165 @@
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+const (
+	gzipEncoding    = "gzip"
+	deflateEncoding = "deflate"
+	minSize         = 256
+)
+
+var supportedEncodings = []string{gzipEncoding, deflateEncoding}
+
+var incompressibleTypes = []string{
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/x-bzip2",
+	"font/woff",
+	"font/woff2",
+	"text/event-stream",
+}
+
+func Compress(next server.Handler) server.Handler {
+	return func(w *response.Writer, r *request.Request) {
+		if r.RequestLine.Method == "HEAD" {
+			next(w, r)
+			return
+		}
+
+		ae, _ := r.Headers.Get("Accept-Encoding")
+		encoding := negotiate(ae)
+		w.UseEncoding(func(statusCode response.StatusCode, hdrs headers.Headers) response.BodyEncoder {
+			if !compressible(statusCode, hdrs) {
+				return nil
+			}
+			addVary(hdrs, "Accept-Encoding")
+			if encoding == "" {
+				return nil
+			}
+
+			hdrs.Set("Content-Encoding", encoding)
+			if etag, ok := hdrs.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+				hdrs.Set("ETag", "W/"+etag)
+			}
+			return encoderFor(encoding)
+		})
+		next(w, r)
+	}
+}
+
+func negotiate(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		weights[coding] = parseQ(params)
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supportedEncodings {
+		q, ok := weights[enc]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+func parseQ(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		key, val, ok := strings.Cut(param, "=")
+		if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
+
+func compressible(statusCode response.StatusCode, hdrs headers.Headers) bool {
+	if statusCode < 200 || statusCode == 204 || statusCode == response.NotModifiedStatus {
+		return false
+	}
+	if _, ok := hdrs.Get("Content-Encoding"); ok {
+		return false
+	}
+	if _, ok := hdrs.Get("Content-Range"); ok {
+		return false
+	}
+	if cl, ok := hdrs.Get("Content-Length"); ok {
+		if n, err := strconv.Atoi(cl); err == nil && n < minSize {
+			return false
+		}
+	}
+
+	ctype, _ := hdrs.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return true
+	}
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	if strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "video/") ||
+		strings.HasPrefix(mediaType, "audio/") {
+		return false
+	}
+	return !slices.Contains(incompressibleTypes, mediaType)
+}
+
+func addVary(hdrs headers.Headers, field string) {
+	vary, ok := hdrs.Get("Vary")
+	if !ok {
+		hdrs.Set("Vary", field)
+		return
+	}
+	for _, v := range strings.Split(vary, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.EqualFold(v, field) {
+			return
+		}
+	}
+	hdrs.Set("Vary", vary, field)
+}
+
+func encoderFor(encoding string) response.BodyEncoder {
+	switch encoding {
+	case gzipEncoding:
+		return func(out io.Writer) io.WriteCloser {
+			return gzip.NewWriter(out)
+		}
+	case deflateEncoding:
+		return func(out io.Writer) io.WriteCloser {
+			return zlib.NewWriter(out)
+		}
+	default:
+		return nil
+	}
+}
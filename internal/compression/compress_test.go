@@ -0,0 +1,114 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var longText = strings.Repeat("hello compression ", 100)
+
+func textHandler(ctype string) func(w *response.Writer, r *request.Request) {
+	return func(w *response.Writer, r *request.Request) {
+		hdrs := response.GetDefaultHeaders(len(longText))
+		hdrs.Set("Content-Type", ctype)
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(hdrs)
+		w.WriteBody([]byte(longText))
+	}
+}
+
+func run(t *testing.T, handler func(w *response.Writer, r *request.Request), acceptEncoding string) *http.Response {
+	t.Helper()
+	raw := "GET / HTTP/1.1\r\nHost: localhost:42069\r\n"
+	if acceptEncoding != "" {
+		raw += "Accept-Encoding: " + acceptEncoding + "\r\n"
+	}
+	rq, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	Compress(handler)(&w, rq)
+
+	res, err := http.ReadResponse(bufio.NewReader(out), nil)
+	require.NoError(t, err)
+	return res
+}
+
+func TestNegotiate(t *testing.T) {
+	assert.Equal(t, "gzip", negotiate("gzip, deflate, br"))
+	assert.Equal(t, "deflate", negotiate("gzip;q=0.5, deflate"))
+	assert.Equal(t, "gzip", negotiate("*"))
+	assert.Equal(t, "deflate", negotiate("*;q=0.3, gzip;q=0"))
+	assert.Equal(t, "", negotiate("br, identity"))
+	assert.Equal(t, "", negotiate(""))
+}
+
+func TestCompressGzip(t *testing.T) {
+	res := run(t, textHandler("text/plain"), "gzip")
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+	assert.Equal(t, int64(-1), res.ContentLength)
+
+	gz, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, longText, string(data))
+}
+
+func TestCompressDeflate(t *testing.T) {
+	res := run(t, textHandler("text/html"), "deflate")
+	assert.Equal(t, "deflate", res.Header.Get("Content-Encoding"))
+
+	zr, err := zlib.NewReader(res.Body)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, longText, string(data))
+}
+
+func TestCompressChunkedBody(t *testing.T) {
+	handler := func(w *response.Writer, r *request.Request) {
+		hdrs := response.GetDefaultHeaders(0)
+		hdrs.Remove("Content-Length")
+		hdrs.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(hdrs)
+		w.WriteChunkedBody([]byte("first "))
+		w.WriteChunkedBody([]byte("second"))
+		w.WriteChunkedBodyDone()
+	}
+	res := run(t, handler, "gzip")
+	gz, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "first second", string(data))
+}
+
+func TestSkipCompression(t *testing.T) {
+	res := run(t, textHandler("video/mp4"), "gzip")
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+	assert.Empty(t, res.Header.Get("Vary"))
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, longText, string(data))
+
+	res = run(t, textHandler("text/plain"), "")
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	assert.Equal(t, int64(len(longText)), res.ContentLength)
+}
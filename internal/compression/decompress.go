@@ -0,0 +1,98 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+var (
+	errBodyTooLarge        = errors.New("decompressed body too large")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+func Decompress(next server.Handler, maxSize int64) server.Handler {
+	return func(w *response.Writer, r *request.Request) {
+		ce, ok := r.Headers.Get("Content-Encoding")
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		body, err := DecodeBody(r.Body, ce, maxSize)
+		switch {
+		case errors.Is(err, errUnsupportedEncoding):
+			msg := err.Error()
+			hdrs := response.GetDefaultHeaders(len(msg))
+			hdrs.Set("Accept-Encoding", strings.Join(supportedEncodings, ", "))
+			w.WriteStatusLine(response.UnsupportedMediaTypeStatus)
+			w.WriteHeaders(hdrs)
+			w.WriteBody([]byte(msg))
+			return
+		case errors.Is(err, errBodyTooLarge):
+			server.HandlerError{StatusCode: response.ContentTooLargeStatus, Message: err.Error()}.Write(w)
+			return
+		case err != nil:
+			server.HandlerError{StatusCode: response.BadRequestStatus, Message: "malformed encoded body"}.Write(w)
+			return
+		}
+
+		r.Body = body
+		r.Headers.Remove("Content-Encoding")
+		r.Headers.Set("Content-Length", strconv.Itoa(len(body)))
+		next(w, r)
+	}
+}
+
+// DecodeBody undoes the codings listed in a Content-Encoding value, last one
+// first, and fails once the decoded body grows past maxSize.
+func DecodeBody(body []byte, contentEncoding string, maxSize int64) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+
+		dec, err := decoderFor(coding, body)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := io.ReadAll(io.LimitReader(dec, maxSize+1))
+		dec.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(decoded)) > maxSize {
+			return nil, errBodyTooLarge
+		}
+		body = decoded
+	}
+	return body, nil
+}
+
+func decoderFor(coding string, body []byte) (io.ReadCloser, error) {
+	switch coding {
+	case gzipEncoding, "x-gzip":
+		return gzip.NewReader(bytes.NewReader(body))
+	case deflateEncoding:
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err == nil {
+			return zr, nil
+		}
+		return flate.NewReader(bufio.NewReader(bytes.NewReader(body))), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, coding)
+	}
+}
@@ -0,0 +1,84 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoHandler(w *response.Writer, r *request.Request) {
+	w.WriteStatusLine(response.OkStatus)
+	w.WriteHeaders(response.GetDefaultHeaders(len(r.Body)))
+	w.WriteBody(r.Body)
+}
+
+func postEncoded(t *testing.T, encoding string, body []byte, maxSize int64) (*http.Response, string) {
+	t.Helper()
+	raw := fmt.Sprintf("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Encoding: %s\r\nContent-Length: %d\r\n\r\n", encoding, len(body))
+	rq, err := request.RequestFromReader(io.MultiReader(strings.NewReader(raw), bytes.NewReader(body)))
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	Decompress(echoHandler, maxSize)(&w, rq)
+
+	res, err := http.ReadResponse(bufio.NewReader(out), nil)
+	require.NoError(t, err)
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(data)
+}
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestDecompressGzipBody(t *testing.T) {
+	res, body := postEncoded(t, "gzip", gzipBytes(t, "hello world!"), 1024)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "hello world!", body)
+}
+
+func TestDecompressDeflateBody(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zlib.NewWriter(buf)
+	zw.Write([]byte("deflated body"))
+	zw.Close()
+
+	res, body := postEncoded(t, "deflate", buf.Bytes(), 1024)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "deflated body", body)
+}
+
+func TestDecompressLimit(t *testing.T) {
+	res, _ := postEncoded(t, "gzip", gzipBytes(t, strings.Repeat("a", 4096)), 1024)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+}
+
+func TestDecompressUnknownEncoding(t *testing.T) {
+	res, _ := postEncoded(t, "br", []byte("whatever"), 1024)
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	assert.Equal(t, "gzip, deflate", res.Header.Get("Accept-Encoding"))
+}
+
+func TestDecompressMalformedBody(t *testing.T) {
+	res, _ := postEncoded(t, "gzip", []byte("not gzip at all"), 1024)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,198 @@
+package cookie
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+)
+
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+type Cookie struct {
+	Name        string
+	Value       string
+	Path        string
+	Domain      string
+	Expires     time.Time
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+func Parse(header string) []*Cookie {
+	var cookies []*Cookie
+	for _, part := range strings.FieldsFunc(header, func(r rune) bool { return r == ';' || r == ',' }) {
+		name, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || !validName(name) {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		if len(val) > 1 && strings.HasPrefix(val, `"`) && strings.HasSuffix(val, `"`) {
+			val = val[1 : len(val)-1]
+		}
+		if !validValue(val) {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: val})
+	}
+	return cookies
+}
+
+var expiresLayouts = []string{
+	headers.TimeFormat,
+	"Mon, 02-Jan-2006 15:04:05 MST",
+	"Monday, 02-Jan-06 15:04:05 MST",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+func ParseSetCookie(line string) (*Cookie, error) {
+	parts := strings.Split(line, ";")
+	name, val, ok := strings.Cut(strings.TrimSpace(parts[0]), "=")
+	name = strings.TrimSpace(name)
+	val = strings.TrimSpace(val)
+	if !ok || !validName(name) {
+		return nil, fmt.Errorf("invalid Set-Cookie name: %q", line)
+	}
+	if len(val) > 1 && strings.HasPrefix(val, `"`) && strings.HasSuffix(val, `"`) {
+		val = val[1 : len(val)-1]
+	}
+	if !validValue(val) {
+		return nil, fmt.Errorf("invalid Set-Cookie value for %s", name)
+	}
+
+	c := &Cookie{Name: name, Value: val}
+	for _, attr := range parts[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		val = strings.TrimSpace(val)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "path":
+			c.Path = val
+		case "domain":
+			c.Domain = strings.ToLower(strings.TrimPrefix(val, "."))
+		case "expires":
+			for _, layout := range expiresLayouts {
+				if t, err := time.Parse(layout, val); err == nil {
+					c.Expires = t.UTC()
+					break
+				}
+			}
+		case "max-age":
+			secs, err := strconv.Atoi(val)
+			if err != nil {
+				continue
+			}
+			c.MaxAge = secs
+			if secs <= 0 {
+				c.MaxAge = -1
+			}
+		case "secure":
+			c.Secure = true
+		case "httponly":
+			c.HttpOnly = true
+		case "samesite":
+			switch strings.ToLower(val) {
+			case "lax":
+				c.SameSite = SameSiteLax
+			case "strict":
+				c.SameSite = SameSiteStrict
+			case "none":
+				c.SameSite = SameSiteNone
+			}
+		case "partitioned":
+			c.Partitioned = true
+		}
+	}
+	return c, nil
+}
+
+func (c *Cookie) Valid() error {
+	if !validName(c.Name) {
+		return fmt.Errorf("invalid cookie name: %q", c.Name)
+	}
+	if !validValue(c.Value) {
+		return fmt.Errorf("invalid cookie value for %s", c.Name)
+	}
+	if strings.ContainsAny(c.Path, ";\r\n") {
+		return fmt.Errorf("invalid cookie path: %q", c.Path)
+	}
+	if strings.ContainsAny(c.Domain, "; \r\n") {
+		return fmt.Errorf("invalid cookie domain: %q", c.Domain)
+	}
+	if c.Partitioned && !c.Secure {
+		return fmt.Errorf("partitioned cookie %s must be secure", c.Name)
+	}
+	return nil
+}
+
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + headers.FormatTime(c.Expires))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func validValue(val string) bool {
+	for _, r := range val {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune("\",;\\", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCookieHeader(t *testing.T) {
+	cookies := Parse(`session=abc123; theme="dark"; bad name=x; empty=`)
+	require.Len(t, cookies, 3)
+	assert.Equal(t, &Cookie{Name: "session", Value: "abc123"}, cookies[0])
+	assert.Equal(t, &Cookie{Name: "theme", Value: "dark"}, cookies[1])
+	assert.Equal(t, &Cookie{Name: "empty", Value: ""}, cookies[2])
+}
+
+func TestParseJoinedCookieHeaders(t *testing.T) {
+	cookies := Parse("a=1; b=2, c=3")
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "c", cookies[2].Name)
+	assert.Equal(t, "3", cookies[2].Value)
+}
+
+func TestCookieString(t *testing.T) {
+	c := &Cookie{
+		Name:        "id",
+		Value:       "a3fWa",
+		Path:        "/",
+		Domain:      ".example.com",
+		Expires:     time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteStrict,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "id=a3fWa; Path=/; Domain=example.com; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=3600; HttpOnly; Secure; SameSite=Strict; Partitioned", c.String())
+
+	c = &Cookie{Name: "gone", Value: "", MaxAge: -1}
+	assert.Equal(t, "gone=; Max-Age=0", c.String())
+}
+
+func TestInvalidCookies(t *testing.T) {
+	assert.Error(t, (&Cookie{Name: "", Value: "x"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a;b", Value: "x"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Value: "x y"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Value: "x", Path: "/\r\nInjected: 1"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Value: "x", Partitioned: true}).Valid())
+}
+
+func TestParseSetCookie(t *testing.T) {
+	c, err := ParseSetCookie(`id="a3fWa"; Path=/docs; Domain=.Example.com; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=Lax`)
+	require.NoError(t, err)
+	assert.Equal(t, &Cookie{
+		Name:     "id",
+		Value:    "a3fWa",
+		Path:     "/docs",
+		Domain:   "example.com",
+		Expires:  time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC),
+		MaxAge:   3600,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: SameSiteLax,
+	}, c)
+
+	c, err = ParseSetCookie("gone=; Max-Age=0; Expires=Sunday, 06-Nov-94 08:49:37 GMT")
+	require.NoError(t, err)
+	assert.Equal(t, -1, c.MaxAge)
+	assert.Equal(t, 1994, c.Expires.Year())
+
+	_, err = ParseSetCookie("no-equals-sign")
+	assert.Error(t, err)
+	_, err = ParseSetCookie("a=b c")
+	assert.Error(t, err)
+}
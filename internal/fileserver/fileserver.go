@@ -0,0 +1,320 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+const (
+	indexPage = "index.html"
+	sniffLen  = 512
+)
+
+type FileServer struct {
+	Root            string
+	Prefix          string
+	ListDirectories bool
+}
+
+func New(root string) *FileServer {
+	return &FileServer{Root: root}
+}
+
+func (fsrv *FileServer) Handle(w *response.Writer, r *request.Request) {
+	if !allowedMethod(w, r) {
+		return
+	}
+
+	target, err := url.ParseRequestURI(r.RequestLine.RequestTarget)
+	if err != nil {
+		server.HandlerError{StatusCode: response.BadRequestStatus, Message: "malformed request target"}.Write(w)
+		return
+	}
+
+	urlPath, ok := strings.CutPrefix(target.Path, fsrv.Prefix)
+	// The prefix has to end at a segment boundary, so /static doesn't
+	// match /staticfoo.
+	if !ok || urlPath != "" && !strings.HasPrefix(urlPath, "/") && !strings.HasSuffix(fsrv.Prefix, "/") {
+		server.HandlerError{StatusCode: response.NotFoundStatus, Message: "not found"}.Write(w)
+		return
+	}
+	if containsDotDot(urlPath) || strings.ContainsRune(urlPath, 0) {
+		server.HandlerError{StatusCode: response.BadRequestStatus, Message: "invalid path"}.Write(w)
+		return
+	}
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	cleanPath := path.Clean(urlPath)
+	name := filepath.Join(fsrv.Root, filepath.FromSlash(cleanPath))
+
+	f, err := os.Open(name)
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+
+	if !info.IsDir() {
+		serveContent(w, r, info, f)
+		return
+	}
+
+	if !strings.HasSuffix(target.Path, "/") {
+		redirect(w, target.Path+"/")
+		return
+	}
+
+	index, err := os.Open(filepath.Join(name, indexPage))
+	if err == nil {
+		defer index.Close()
+		indexInfo, err := index.Stat()
+		if err == nil && !indexInfo.IsDir() {
+			serveContent(w, r, indexInfo, index)
+			return
+		}
+	}
+
+	if !fsrv.ListDirectories {
+		server.HandlerError{StatusCode: response.ForbiddenStatus, Message: "directory listing not allowed"}.Write(w)
+		return
+	}
+	listDirectory(w, r, target.Path, f)
+}
+
+func ServeFile(w *response.Writer, r *request.Request, name string) {
+	if !allowedMethod(w, r) {
+		return
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	if info.IsDir() {
+		server.HandlerError{StatusCode: response.ForbiddenStatus, Message: "is a directory"}.Write(w)
+		return
+	}
+
+	serveContent(w, r, info, f)
+}
+
+func serveContent(w *response.Writer, r *request.Request, info fs.FileInfo, f io.ReadSeeker) {
+	extra := headers.NewHeaders()
+	extra.Set("ETag", fileETag(info))
+	ServeContent(w, r, info.Name(), info.ModTime(), f, extra)
+}
+
+func fileETag(info fs.FileInfo) string {
+	return response.StrongETag(fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()))
+}
+
+func ServeContent(w *response.Writer, r *request.Request, name string, modtime time.Time, content io.ReadSeeker, extra headers.Headers) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		server.HandlerError{StatusCode: response.InternalServerErrorStatus, Message: "could not read content"}.Write(w)
+		return
+	}
+
+	hdrs := response.GetDefaultHeaders(int(size))
+	for key, val := range extra {
+		hdrs.Set(key, val)
+	}
+	if _, ok := extra.Get("Content-Type"); !ok {
+		ctype, err := contentType(name, content)
+		if err != nil {
+			server.HandlerError{StatusCode: response.InternalServerErrorStatus, Message: "could not read content"}.Write(w)
+			return
+		}
+		hdrs.Set("Content-Type", ctype)
+	}
+	if !modtime.IsZero() {
+		hdrs.Set("Last-Modified", headers.FormatTime(modtime))
+	}
+	hdrs.Set("Accept-Ranges", "bytes")
+
+	etag, _ := hdrs.Get("ETag")
+	if response.CheckPreconditions(w, r, etag, modtime) {
+		return
+	}
+
+	var ranges []ByteRange
+	if rangeHeader, ok := r.Headers.Get("Range"); ok && ifRangeMatches(r.Headers, etag, modtime) {
+		ranges, err = ParseRange(rangeHeader, size)
+		if errors.Is(err, ErrUnsatisfiableRange) {
+			hdrs.Set("Content-Length", "0")
+			hdrs.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteStatusLine(response.RangeNotSatisfiableStatus)
+			w.WriteHeaders(hdrs)
+			w.WriteBody(nil)
+			return
+		}
+		if err != nil || sumRanges(ranges) > size {
+			ranges = nil
+		}
+	}
+
+	var body io.Reader = io.LimitReader(content, size)
+	status := response.OkStatus
+	switch len(ranges) {
+	case 0:
+	case 1:
+		status = response.PartialContentStatus
+		if _, err := content.Seek(ranges[0].Start, io.SeekStart); err != nil {
+			server.HandlerError{StatusCode: response.InternalServerErrorStatus, Message: "could not read content"}.Write(w)
+			return
+		}
+		hdrs.Set("Content-Length", strconv.FormatInt(ranges[0].Length, 10))
+		hdrs.Set("Content-Range", ranges[0].ContentRange(size))
+		body = io.LimitReader(content, ranges[0].Length)
+	default:
+		status = response.PartialContentStatus
+		ctype, _ := hdrs.Get("Content-Type")
+		mp := newMultipartRanges(content, ranges, ctype, size)
+		hdrs.Set("Content-Length", strconv.FormatInt(mp.length(), 10))
+		hdrs.Set("Content-Type", "multipart/byteranges; boundary="+mp.boundary)
+		body = mp
+	}
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(hdrs)
+	if r.RequestLine.Method == "HEAD" {
+		w.WriteBody(nil)
+		return
+	}
+	w.WriteBodyFrom(body)
+}
+
+func sumRanges(ranges []ByteRange) int64 {
+	var total int64
+	for _, br := range ranges {
+		total += br.Length
+	}
+	return total
+}
+
+func contentType(name string, f io.ReadSeeker) (string, error) {
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		return ctype, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func listDirectory(w *response.Writer, r *request.Request, urlPath string, dir *os.File) {
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		server.HandlerError{StatusCode: response.InternalServerErrorStatus, Message: "could not read directory"}.Write(w)
+		return
+	}
+	slices.SortFunc(entries, func(a, b os.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	var bdy strings.Builder
+	title := html.EscapeString(urlPath)
+	fmt.Fprintf(&bdy, "<html>\n<head>\n<title>Index of %s</title>\n</head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(&bdy, "<li><a href=\"%s\">%s</a></li>\n", link.String(), html.EscapeString(name))
+	}
+	bdy.WriteString("</ul>\n</body>\n</html>\n")
+
+	hdrs := response.GetDefaultHeaders(bdy.Len())
+	hdrs.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteStatusLine(response.OkStatus)
+	w.WriteHeaders(hdrs)
+	if r.RequestLine.Method == "HEAD" {
+		w.WriteBody(nil)
+		return
+	}
+	w.WriteBody([]byte(bdy.String()))
+}
+
+func allowedMethod(w *response.Writer, r *request.Request) bool {
+	if r.RequestLine.Method == "GET" || r.RequestLine.Method == "HEAD" {
+		return true
+	}
+	msg := "method not allowed"
+	hdrs := response.GetDefaultHeaders(len(msg))
+	hdrs.Set("Allow", "GET, HEAD")
+	w.WriteStatusLine(response.MethodNotAllowedStatus)
+	w.WriteHeaders(hdrs)
+	w.WriteBody([]byte(msg))
+	return false
+}
+
+func redirect(w *response.Writer, location string) {
+	hdrs := response.GetDefaultHeaders(0)
+	hdrs.Set("Location", (&url.URL{Path: location}).String())
+	w.WriteStatusLine(response.MovedPermanentlyStatus)
+	w.WriteHeaders(hdrs)
+	w.WriteBody(nil)
+}
+
+func writeOpenError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		server.HandlerError{StatusCode: response.NotFoundStatus, Message: "not found"}.Write(w)
+	case errors.Is(err, fs.ErrPermission):
+		server.HandlerError{StatusCode: response.ForbiddenStatus, Message: "forbidden"}.Write(w)
+	default:
+		server.HandlerError{StatusCode: response.InternalServerErrorStatus, Message: "could not open file"}.Write(w)
+	}
+}
+
+func containsDotDot(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
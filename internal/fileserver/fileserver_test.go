@@ -0,0 +1,132 @@
+package fileserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, fsrv *FileServer, method, target string) string {
+	t.Helper()
+	rq, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	fsrv.Handle(&w, rq)
+	return out.String()
+}
+
+func newTestRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello world"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "blob"), []byte("<html><body>sniffed</body></html>"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "site"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "site", "index.html"), []byte("<h1>index</h1>"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "files"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "files", "a <b>.txt"), []byte("a"), 0o644))
+	return root
+}
+
+func TestServeFileWithExtension(t *testing.T) {
+	fsrv := New(newTestRoot(t))
+	res := serve(t, fsrv, "GET", "/hello.txt")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, res, "Content-Length: 11\r\n")
+	assert.Contains(t, res, "Last-Modified: ")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nhello world"))
+}
+
+func TestServeFileSniffsContentType(t *testing.T) {
+	fsrv := New(newTestRoot(t))
+	res := serve(t, fsrv, "GET", "/blob")
+	assert.Contains(t, res, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.True(t, strings.HasSuffix(res, "<html><body>sniffed</body></html>"))
+}
+
+func TestHeadHasNoBody(t *testing.T) {
+	fsrv := New(newTestRoot(t))
+	res := serve(t, fsrv, "HEAD", "/hello.txt")
+	assert.Contains(t, res, "Content-Length: 11\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"))
+}
+
+func TestPathTraversalIsBlocked(t *testing.T) {
+	fsrv := New(newTestRoot(t))
+	res := serve(t, fsrv, "GET", "/../hello.txt")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 400 Bad Request\r\n"))
+
+	res = serve(t, fsrv, "GET", "/site/%2e%2e/%2e%2e/etc/passwd")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 400 Bad Request\r\n"))
+}
+
+func TestMissingFileIsNotFound(t *testing.T) {
+	fsrv := New(newTestRoot(t))
+	res := serve(t, fsrv, "GET", "/nope.txt")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+}
+
+func TestDirectoryIndexAndRedirect(t *testing.T) {
+	fsrv := New(newTestRoot(t))
+	res := serve(t, fsrv, "GET", "/site")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, res, "Location: /site/\r\n")
+
+	res = serve(t, fsrv, "GET", "/site/")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(res, "<h1>index</h1>"))
+}
+
+func TestDirectoryListing(t *testing.T) {
+	fsrv := New(newTestRoot(t))
+	res := serve(t, fsrv, "GET", "/files/")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 403 Forbidden\r\n"))
+
+	fsrv.ListDirectories = true
+	res = serve(t, fsrv, "GET", "/files/")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, `<a href="a%20%3Cb%3E.txt">a &lt;b&gt;.txt</a>`)
+}
+
+func TestPrefixAndMethod(t *testing.T) {
+	fsrv := &FileServer{Root: newTestRoot(t), Prefix: "/static"}
+	res := serve(t, fsrv, "GET", "/static/hello.txt?v=1")
+	assert.True(t, strings.HasSuffix(res, "hello world"))
+
+	res = serve(t, fsrv, "GET", "/statichello.txt")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	res = serve(t, &FileServer{Root: fsrv.Root, Prefix: "/static/"}, "GET", "/static/hello.txt")
+	assert.True(t, strings.HasSuffix(res, "hello world"))
+
+	res = serve(t, fsrv, "POST", "/static/hello.txt")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "Allow: GET, HEAD\r\n")
+}
+
+func TestConditionalFileRequest(t *testing.T) {
+	root := newTestRoot(t)
+	info, err := os.Stat(filepath.Join(root, "hello.txt"))
+	require.NoError(t, err)
+	etag := fileETag(info)
+
+	res := serve(t, New(root), "GET", "/hello.txt")
+	assert.Contains(t, res, "Etag: "+etag+"\r\n")
+
+	rq, err := request.RequestFromReader(strings.NewReader("GET /hello.txt HTTP/1.1\r\nIf-None-Match: " + etag + "\r\n\r\n"))
+	require.NoError(t, err)
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	New(root).Handle(&w, rq)
+	assert.True(t, strings.HasPrefix(out.String(), "HTTP/1.1 304 Not Modified\r\n"))
+	assert.NotContains(t, out.String(), "hello world")
+}
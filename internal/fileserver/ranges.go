@@ -0,0 +1,172 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+)
+
+const maxRanges = 64
+
+var (
+	ErrInvalidRange       = errors.New("invalid range")
+	ErrUnsatisfiableRange = errors.New("unsatisfiable range")
+)
+
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+func (br ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.Start, br.Start+br.Length-1, size)
+}
+
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok {
+		return nil, ErrInvalidRange
+	}
+
+	var ranges []ByteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var br ByteRange
+		if first == "" {
+			suffix, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, ErrInvalidRange
+			}
+			if suffix == 0 || size == 0 {
+				continue
+			}
+			suffix = min(suffix, size)
+			br = ByteRange{Start: size - suffix, Length: suffix}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, ErrInvalidRange
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, ErrInvalidRange
+				}
+				end = min(end, size-1)
+			}
+			if start >= size {
+				continue
+			}
+			br = ByteRange{Start: start, Length: end - start + 1}
+		}
+		ranges = append(ranges, br)
+	}
+
+	if len(ranges) > maxRanges {
+		return nil, ErrInvalidRange
+	}
+	if len(ranges) == 0 {
+		return nil, ErrUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+func ifRangeMatches(reqHeaders headers.Headers, etag string, modtime time.Time) bool {
+	ifRange, ok := reqHeaders.Get("If-Range")
+	if !ok {
+		return true
+	}
+	ifRange = strings.TrimSpace(ifRange)
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return ifRange == etag && !strings.HasPrefix(etag, "W/")
+	}
+
+	t, err := headers.ParseTime(ifRange)
+	if err != nil || modtime.IsZero() {
+		return false
+	}
+	return t.Equal(modtime.Truncate(time.Second))
+}
+
+type multipartRanges struct {
+	content  io.ReadSeeker
+	ranges   []ByteRange
+	parts    []string
+	trailer  string
+	boundary string
+	current  io.Reader
+	idx      int
+}
+
+func newMultipartRanges(content io.ReadSeeker, ranges []ByteRange, ctype string, size int64) *multipartRanges {
+	boundary := rand.Text()
+	mp := &multipartRanges{
+		content:  content,
+		ranges:   ranges,
+		boundary: boundary,
+		trailer:  fmt.Sprintf("\r\n--%s--\r\n", boundary),
+	}
+	for i, br := range ranges {
+		sep := "\r\n"
+		if i == 0 {
+			sep = ""
+		}
+		mp.parts = append(mp.parts, fmt.Sprintf("%s--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n",
+			sep, boundary, ctype, br.ContentRange(size)))
+	}
+	return mp
+}
+
+func (mp *multipartRanges) length() int64 {
+	total := int64(len(mp.trailer))
+	for i, br := range mp.ranges {
+		total += int64(len(mp.parts[i])) + br.Length
+	}
+	return total
+}
+
+func (mp *multipartRanges) Read(p []byte) (int, error) {
+	for {
+		if mp.current != nil {
+			n, err := mp.current.Read(p)
+			if n > 0 || !errors.Is(err, io.EOF) {
+				return n, err
+			}
+			mp.current = nil
+		}
+		if mp.idx > 2*len(mp.ranges) {
+			return 0, io.EOF
+		}
+
+		switch {
+		case mp.idx == 2*len(mp.ranges):
+			mp.current = strings.NewReader(mp.trailer)
+		case mp.idx%2 == 0:
+			mp.current = strings.NewReader(mp.parts[mp.idx/2])
+		default:
+			br := mp.ranges[mp.idx/2]
+			if _, err := mp.content.Seek(br.Start, io.SeekStart); err != nil {
+				return 0, err
+			}
+			mp.current = io.LimitReader(mp.content, br.Length)
+		}
+		mp.idx++
+	}
+}
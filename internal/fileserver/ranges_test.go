@@ -0,0 +1,129 @@
+package fileserver
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rangeContent = "0123456789abcdefghij"
+
+var rangeModTime = time.Date(2025, time.May, 1, 10, 0, 0, 0, time.UTC)
+
+func serveRange(t *testing.T, extraRequestHeaders string, extra headers.Headers) string {
+	t.Helper()
+	rq, err := request.RequestFromReader(strings.NewReader("GET /file.txt HTTP/1.1\r\nHost: localhost:42069\r\n" + extraRequestHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	ServeContent(&w, rq, "file.txt", rangeModTime, strings.NewReader(rangeContent), extra)
+	return out.String()
+}
+
+func TestParseRange(t *testing.T) {
+	ranges, err := ParseRange("bytes=0-4", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 5}}, ranges)
+
+	ranges, err = ParseRange("bytes=15-", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 15, Length: 5}}, ranges)
+
+	ranges, err = ParseRange("bytes=-3, 2-2, 18-100", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 17, Length: 3}, {Start: 2, Length: 1}, {Start: 18, Length: 2}}, ranges)
+
+	_, err = ParseRange("bytes=20-30", 20)
+	assert.ErrorIs(t, err, ErrUnsatisfiableRange)
+
+	_, err = ParseRange("items=0-1", 20)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+
+	_, err = ParseRange("bytes=5-1", 20)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestServeContentWithoutRange(t *testing.T) {
+	res := serveRange(t, "", nil)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "Accept-Ranges: bytes\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"+rangeContent))
+}
+
+func TestServeContentSingleRange(t *testing.T) {
+	res := serveRange(t, "Range: bytes=5-9\r\n", nil)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, res, "Content-Range: bytes 5-9/20\r\n")
+	assert.Contains(t, res, "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n56789"))
+}
+
+func TestServeContentMultipleRanges(t *testing.T) {
+	res := serveRange(t, "Range: bytes=0-1,-2\r\n", nil)
+	require.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+
+	head, body, ok := strings.Cut(res, "\r\n\r\n")
+	require.True(t, ok)
+	var ctype string
+	for _, line := range strings.Split(head, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "Content-Type: "); ok {
+			ctype = v
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(ctype)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(body)))
+
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	expected := []struct{ contentRange, data string }{
+		{"bytes 0-1/20", "01"},
+		{"bytes 18-19/20", "ij"},
+	}
+	for _, exp := range expected {
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, exp.contentRange, part.Header.Get("Content-Range"))
+		assert.Equal(t, "text/plain; charset=utf-8", part.Header.Get("Content-Type"))
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, exp.data, string(data))
+	}
+	_, err = mr.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServeContentUnsatisfiableRange(t *testing.T) {
+	res := serveRange(t, "Range: bytes=50-\r\n", nil)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, res, "Content-Range: bytes */20\r\n")
+}
+
+func TestServeContentIfRange(t *testing.T) {
+	extra := headers.NewHeaders()
+	extra.Set("ETag", `"v1"`)
+
+	res := serveRange(t, "Range: bytes=0-0\r\nIf-Range: \"v1\"\r\n", extra)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+
+	res = serveRange(t, "Range: bytes=0-0\r\nIf-Range: \"v0\"\r\n", extra)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+
+	res = serveRange(t, "Range: bytes=0-0\r\nIf-Range: "+headers.FormatTime(rangeModTime)+"\r\n", nil)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 206 Partial Content\r\n"))
+
+	res = serveRange(t, "Range: bytes=0-0\r\nIf-Range: "+headers.FormatTime(rangeModTime.Add(-time.Hour))+"\r\n", nil)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+}
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 	"unicode"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
 type Headers map[string]string
 
 func NewHeaders() Headers {
@@ -62,11 +65,17 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 func (h Headers) Get(key string) (string, bool) {
 	caser := cases.Title(language.English)
 	val, ok := h[caser.String(key)]
+	if !ok {
+		val, ok = h[strings.ToLower(key)]
+	}
 	return val, ok
 }
 func (h Headers) Set(key string, values... string) {
 	caser := cases.Title(language.English)
 	cleanKey := caser.String(key)
+	if lowKey := strings.ToLower(key); lowKey != cleanKey {
+		delete(h, lowKey)
+	}
 	h[cleanKey] = values[0]
 	if len(values) > 1 {
 		for _, val := range values[1:] {
@@ -77,8 +86,16 @@ func (h Headers) Set(key string, values... string) {
 func (h Headers) Remove(key string) {
 	caser := cases.Title(language.English)
 	delete(h, caser.String(key))
+	delete(h, strings.ToLower(key))
 }
 
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+func ParseTime(s string) (time.Time, error) {
+	return time.Parse(TimeFormat, s)
+}
 
 func checkFieldName(fn string) bool {
 	allowed := "!#$%&'*+-.^_`|~"
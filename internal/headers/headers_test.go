@@ -118,3 +118,22 @@ func TestSetHeaders(t *testing.T) {
 	assert.Equal(t, "primera cosa, segunda cosa", auth)
 
 }
+
+func TestGetParsedHeaders(t *testing.T) {
+	hdrs := NewHeaders()
+	_, _, err := hdrs.Parse([]byte("Content-Length: 13\r\n"))
+	require.NoError(t, err)
+
+	cl, ok := hdrs.Get("Content-Length")
+	require.True(t, ok)
+	assert.Equal(t, "13", cl)
+
+	hdrs.Set("content-length", "20")
+	assert.Len(t, hdrs, 1)
+	cl, ok = hdrs.Get("CONTENT-LENGTH")
+	require.True(t, ok)
+	assert.Equal(t, "20", cl)
+
+	hdrs.Remove("Content-Length")
+	assert.Empty(t, hdrs)
+}
@@ -0,0 +1,91 @@
+package httpu
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+)
+
+// MaxDatagramSize is the largest UDP payload over IPv4.
+const MaxDatagramSize = 65507
+
+var ErrIncompleteMessage = errors.New("datagram does not end its header section with an empty line")
+
+// ParseRequest parses one datagram as one request. HTTPU has no body
+// framing, so whatever follows the header section is the body, and
+// Content-Length and Transfer-Encoding are dropped before the header section
+// reaches the request parser, which would otherwise wait for the body itself.
+func ParseRequest(datagram []byte) (*request.Request, error) {
+	i := bytes.Index(datagram, []byte("\r\n\r\n"))
+	if i == -1 {
+		return nil, ErrIncompleteMessage
+	}
+	rq, err := request.RequestFromReader(bytes.NewReader(stripFraming(datagram[:i+2])))
+	if err != nil {
+		return nil, err
+	}
+	rq.Body = bytes.Clone(datagram[i+4:])
+	return rq, nil
+}
+
+// stripFraming returns head, which ends with the CRLF of its last line, with
+// the body framing fields removed and the empty line appended.
+func stripFraming(head []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(head, []byte("\r\n")) {
+		name, _, _ := bytes.Cut(line, []byte(":"))
+		name = bytes.TrimSpace(name)
+		if bytes.EqualFold(name, []byte("Content-Length")) || bytes.EqualFold(name, []byte("Transfer-Encoding")) {
+			continue
+		}
+		out.Write(line)
+	}
+	out.WriteString("\r\n")
+	return out.Bytes()
+}
+
+func ParseResponse(datagram []byte) (*client.Response, error) {
+	if !bytes.Contains(datagram, []byte("\r\n\r\n")) {
+		return nil, ErrIncompleteMessage
+	}
+	return client.ReadResponse(bufio.NewReader(bytes.NewReader(datagram)), "GET")
+}
+
+// MarshalRequest builds a request datagram. Host goes first and the other
+// fields follow in name order, keeping the names exactly as given since some
+// SSDP stacks compare them case-sensitively.
+func MarshalRequest(method, target string, hdrs headers.Headers, body []byte) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", method, target)
+
+	keys := make([]string, 0, len(hdrs))
+	for key := range hdrs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, c int) bool {
+		hostA, hostC := strings.EqualFold(keys[a], "Host"), strings.EqualFold(keys[c], "Host")
+		if hostA != hostC {
+			return hostA
+		}
+		return keys[a] < keys[c]
+	})
+	for _, key := range keys {
+		if strings.ContainsAny(key+hdrs[key], "\r\n") {
+			return nil, fmt.Errorf("invalid header %q", key)
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", key, hdrs[key])
+	}
+	b.WriteString("\r\n")
+	b.Write(body)
+	if b.Len() > MaxDatagramSize {
+		return nil, fmt.Errorf("message of %d bytes does not fit in a datagram", b.Len())
+	}
+	return b.Bytes(), nil
+}
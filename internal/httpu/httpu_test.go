@@ -0,0 +1,215 @@
+package httpu
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequest(t *testing.T) {
+	rq, err := ParseRequest([]byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\nST: ssdp:all\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "M-SEARCH", rq.RequestLine.Method)
+	assert.Equal(t, "*", rq.RequestLine.RequestTarget)
+	assert.Equal(t, "ssdp:all", field(rq.Headers, "St"))
+	assert.Equal(t, `"ssdp:discover"`, field(rq.Headers, "Man"))
+	assert.Empty(t, rq.Body)
+
+	// The body runs to the end of the datagram, Content-Length or not.
+	rq, err = ParseRequest([]byte("NOTIFY /event HTTP/1.1\r\nHost: example\r\nContent-Length: 2\r\n\r\nhello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(rq.Body))
+	assert.Equal(t, "example", field(rq.Headers, "Host"))
+	assert.Empty(t, field(rq.Headers, "Content-Length"))
+
+	rq, err = ParseRequest([]byte("NOTIFY /event HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nhello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(rq.Body))
+
+	_, err = ParseRequest([]byte("M-SEARCH * HTTP/1.1\r\nHOST: a\r\n"))
+	assert.ErrorIs(t, err, ErrIncompleteMessage)
+
+	_, err = ParseRequest([]byte("hello\r\n\r\n"))
+	assert.Error(t, err)
+}
+
+func TestParseResponse(t *testing.T) {
+	res, err := ParseResponse([]byte("HTTP/1.1 200 OK\r\nST: upnp:rootdevice\r\nLOCATION: http://10.0.0.2/desc.xml\r\n\r\n"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 200, res.StatusCode)
+	assert.Equal(t, "upnp:rootdevice", field(res.Headers, "St"))
+	assert.Equal(t, "http://10.0.0.2/desc.xml", field(res.Headers, "Location"))
+
+	_, err = ParseResponse([]byte("HTTP/1.1 200 OK\r\n"))
+	assert.ErrorIs(t, err, ErrIncompleteMessage)
+}
+
+func TestMarshalRequest(t *testing.T) {
+	msg, err := MarshalRequest("M-SEARCH", "*", headers.Headers{
+		"ST":   "ssdp:all",
+		"MX":   "1",
+		"HOST": SSDPAddr,
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMX: 1\r\nST: ssdp:all\r\n\r\n", string(msg))
+
+	_, err = MarshalRequest("NOTIFY", "*", headers.Headers{"NT": "a\r\nX: b"}, nil)
+	assert.Error(t, err)
+
+	_, err = MarshalRequest("NOTIFY", "*", headers.Headers{}, make([]byte, MaxDatagramSize))
+	assert.Error(t, err)
+}
+
+func startServer(t *testing.T, handler func(w *response.Writer, req *request.Request)) string {
+	t.Helper()
+	srv, err := Serve("127.0.0.1:0", handler)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return srv.Addr().String()
+}
+
+func searchHandler(usn string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Method != "M-SEARCH" {
+			return
+		}
+		h := headers.NewHeaders()
+		st, _ := req.Headers.Get("St")
+		h.Set("St", st)
+		h.Set("Usn", usn)
+		h.Set("Location", "http://127.0.0.1:42069/desc.xml")
+		h.Set("Content-Length", "0")
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(h)
+		w.WriteEmptyBody()
+	}
+}
+
+func TestSearchOverLoopback(t *testing.T) {
+	addr := startServer(t, searchHandler("uuid:device-1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	results, err := Search(ctx, addr, "upnp:rootdevice", 1)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.EqualValues(t, 200, results[0].StatusCode)
+	assert.Equal(t, "upnp:rootdevice", field(results[0].Headers, "St"))
+	assert.Equal(t, "uuid:device-1", field(results[0].Headers, "Usn"))
+	assert.Equal(t, addr, results[0].Addr.String())
+}
+
+func TestSearchStopsWithContext(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results, err := Search(ctx, conn.LocalAddr().String(), "ssdp:all", 5)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestNotifyReachesHandlerWithoutReply(t *testing.T) {
+	got := make(chan *request.Request, 2)
+	addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		got <- req
+	})
+
+	require.NoError(t, Notify(addr, Announcement{
+		NT:       "upnp:rootdevice",
+		NTS:      Alive,
+		USN:      "uuid:device-1::upnp:rootdevice",
+		Location: "http://127.0.0.1/desc.xml",
+	}))
+	req := <-got
+	assert.Equal(t, "NOTIFY", req.RequestLine.Method)
+	assert.Equal(t, Alive, field(req.Headers, "Nts"))
+	assert.Equal(t, "max-age=1800", field(req.Headers, "Cache-Control"))
+	assert.Equal(t, "http://127.0.0.1/desc.xml", field(req.Headers, "Location"))
+	assert.True(t, strings.HasPrefix(req.RemoteAddr, "127.0.0.1:"))
+
+	require.NoError(t, Notify(addr, Announcement{NT: "upnp:rootdevice", NTS: ByeBye, USN: "uuid:device-1"}))
+	req = <-got
+	assert.Equal(t, ByeBye, field(req.Headers, "Nts"))
+	assert.Empty(t, field(req.Headers, "Location"))
+	assert.Empty(t, field(req.Headers, "Cache-Control"))
+}
+
+func TestBodyWithContentLengthOverLoopback(t *testing.T) {
+	got := make(chan *request.Request, 1)
+	addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		got <- req
+	})
+
+	conn, err := net.Dial("udp4", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("NOTIFY /event HTTP/1.1\r\nHost: example\r\nContent-Length: 11\r\n\r\nhello world"))
+	require.NoError(t, err)
+
+	select {
+	case req := <-got:
+		assert.Equal(t, "hello world", string(req.Body))
+	case <-time.After(time.Second):
+		t.Fatal("datagram with Content-Length never reached the handler")
+	}
+}
+
+type failingConn struct {
+	net.PacketConn
+	reads atomic.Int32
+}
+
+func (c *failingConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.reads.Add(1)
+	return 0, nil, errors.New("read failed")
+}
+
+func (c *failingConn) Close() error {
+	return nil
+}
+
+func TestListenBacksOffOnReadErrors(t *testing.T) {
+	conn := &failingConn{}
+	srv := start(conn, func(w *response.Writer, req *request.Request) {})
+	time.Sleep(100 * time.Millisecond)
+	srv.Close()
+	assert.Less(t, conn.reads.Load(), int32(10))
+}
+
+func TestMulticastSearch(t *testing.T) {
+	group := "239.255.255.250:41900"
+	srv, err := ServeMulticast(group, nil, searchHandler("uuid:device-2"))
+	if err != nil {
+		t.Skipf("multicast not available: %s", err.Error())
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	results, err := Search(ctx, group, "ssdp:all", 1)
+	require.NoError(t, err)
+	if len(results) == 0 {
+		t.Skip("multicast loopback is not delivered on this host")
+	}
+	assert.Equal(t, "uuid:device-2", field(results[0].Headers, "Usn"))
+}
+
+func field(h headers.Headers, name string) string {
+	val, _ := h.Get(name)
+	return val
+}
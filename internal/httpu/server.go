@@ -0,0 +1,113 @@
+package httpu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+const (
+	minReadRetry = 5 * time.Millisecond
+	maxReadRetry = time.Second
+)
+
+// Server answers HTTPU requests with the same handlers as the TCP server.
+// Everything a handler writes is sent back as a single datagram to the
+// sender; handlers that write nothing send no reply, as NOTIFY expects.
+type Server struct {
+	closed  atomic.Bool
+	conn    net.PacketConn
+	handler server.Handler
+}
+
+func Serve(addr string, handler server.Handler) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting httpu server error: %s", err.Error())
+	}
+	return start(conn, handler), nil
+}
+
+// ServeMulticast joins group, such as SSDPAddr, on ifi or on the system's
+// default interface when ifi is nil.
+func ServeMulticast(group string, ifi *net.Interface, handler server.Handler) (*Server, error) {
+	gaddr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multicast group: %s", err.Error())
+	}
+	conn, err := net.ListenMulticastUDP("udp4", ifi, gaddr)
+	if err != nil {
+		return nil, fmt.Errorf("joining multicast group error: %s", err.Error())
+	}
+	return start(conn, handler), nil
+}
+
+func start(conn net.PacketConn, handler server.Handler) *Server {
+	s := &Server{conn: conn, handler: handler}
+	go s.listen()
+	return s
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *Server) Close() error {
+	s.closed.Store(true)
+	err := s.conn.Close()
+	if err != nil {
+		return fmt.Errorf("closing httpu server error: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *Server) listen() {
+	buf := make([]byte, MaxDatagramSize)
+	var delay time.Duration
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if s.closed.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Back off so a socket that keeps failing doesn't spin the loop.
+			delay = min(max(2*delay, minReadRetry), maxReadRetry)
+			log.Printf("Error reading datagram: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		go s.handle(bytes.Clone(buf[:n]), addr)
+	}
+}
+
+func (s *Server) handle(datagram []byte, addr net.Addr) {
+	rq, err := ParseRequest(datagram)
+	if err != nil {
+		log.Printf("Dropping datagram from %s: %s", addr, err.Error())
+		return
+	}
+	rq.RemoteAddr = addr.String()
+	defer rq.RemoveTempFiles()
+
+	var out bytes.Buffer
+	w := response.NewWriter(&out)
+	s.handler(&w, rq)
+	if out.Len() == 0 {
+		return
+	}
+	if out.Len() > MaxDatagramSize {
+		log.Printf("Dropping %d byte reply to %s: too large for a datagram", out.Len(), addr)
+		return
+	}
+	if _, err := s.conn.WriteTo(out.Bytes(), addr); err != nil {
+		log.Printf("Error replying to %s: %v", addr, err)
+	}
+}
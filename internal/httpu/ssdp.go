@@ -0,0 +1,122 @@
+package httpu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/headers"
+)
+
+const (
+	SSDPAddr = "239.255.255.250:1900"
+
+	Alive  = "ssdp:alive"
+	ByeBye = "ssdp:byebye"
+
+	defaultMaxAge = 1800
+	searchGrace   = 250 * time.Millisecond
+)
+
+type Response struct {
+	*client.Response
+	Addr net.Addr
+}
+
+// Search sends an M-SEARCH for st to addr, normally SSDPAddr, and gathers
+// the responses that arrive within mx seconds, the longest devices may wait
+// before answering. It returns early, without an error, when ctx is done.
+func Search(ctx context.Context, addr, st string, mx int) ([]*Response, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search address: %s", err.Error())
+	}
+	if mx < 1 {
+		mx = 1
+	}
+	msg, err := MarshalRequest("M-SEARCH", "*", headers.Headers{
+		"HOST": addr,
+		"MAN":  `"ssdp:discover"`,
+		"MX":   strconv.Itoa(mx),
+		"ST":   st,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening search socket: %s", err.Error())
+	}
+	defer conn.Close()
+	if _, err := conn.WriteTo(msg, raddr); err != nil {
+		return nil, fmt.Errorf("sending search: %s", err.Error())
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Duration(mx)*time.Second + searchGrace))
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	var results []*Response
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return results, nil
+		}
+		if err != nil {
+			return results, fmt.Errorf("reading search responses: %s", err.Error())
+		}
+		res, err := ParseResponse(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+		results = append(results, &Response{Response: res, Addr: from})
+	}
+}
+
+// Announcement describes a NOTIFY. Location and MaxAge only go out with
+// ssdp:alive.
+type Announcement struct {
+	NT       string
+	NTS      string
+	USN      string
+	Location string
+	MaxAge   int
+}
+
+func Notify(addr string, a Announcement) error {
+	hdrs := headers.Headers{
+		"HOST": addr,
+		"NT":   a.NT,
+		"NTS":  a.NTS,
+		"USN":  a.USN,
+	}
+	if a.NTS != ByeBye {
+		maxAge := a.MaxAge
+		if maxAge <= 0 {
+			maxAge = defaultMaxAge
+		}
+		hdrs["CACHE-CONTROL"] = "max-age=" + strconv.Itoa(maxAge)
+		hdrs["LOCATION"] = a.Location
+	}
+	msg, err := MarshalRequest("NOTIFY", "*", hdrs, nil)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("udp4", addr)
+	if err != nil {
+		return fmt.Errorf("dialing %s: %s", addr, err.Error())
+	}
+	defer conn.Close()
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("sending notify: %s", err.Error())
+	}
+	return nil
+}
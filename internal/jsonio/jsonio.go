@@ -0,0 +1,157 @@
+package jsonio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+)
+
+const (
+	jsonType    = "application/json"
+	problemType = "application/problem+json"
+)
+
+type DecodeError struct {
+	Status response.StatusCode
+	Detail string
+}
+
+func (e *DecodeError) Error() string {
+	return e.Detail
+}
+
+type Problem struct {
+	Type       string
+	Title      string
+	Status     response.StatusCode
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]any, len(p.Extensions)+5)
+	for key, val := range p.Extensions {
+		fields[key] = val
+	}
+	fields["type"] = p.Type
+	if p.Type == "" {
+		fields["type"] = "about:blank"
+	}
+	if p.Title != "" {
+		fields["title"] = p.Title
+	}
+	if p.Status != 0 {
+		fields["status"] = int(p.Status)
+	}
+	if p.Detail != "" {
+		fields["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		fields["instance"] = p.Instance
+	}
+	return json.Marshal(fields)
+}
+
+func Decode(r *request.Request, dst any, maxSize int64) error {
+	ct, _ := r.Headers.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil || (mediaType != jsonType && !strings.HasSuffix(mediaType, "+json")) {
+		return &DecodeError{
+			Status: response.UnsupportedMediaTypeStatus,
+			Detail: "Content-Type must be application/json",
+		}
+	}
+	if int64(len(r.Body)) > maxSize {
+		return &DecodeError{
+			Status: response.ContentTooLargeStatus,
+			Detail: fmt.Sprintf("body must not be larger than %d bytes", maxSize),
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(r.Body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return &DecodeError{
+			Status: response.BadRequestStatus,
+			Detail: decodeErrorDetail(err),
+		}
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return &DecodeError{
+			Status: response.BadRequestStatus,
+			Detail: "body must only contain a single JSON value",
+		}
+	}
+	return nil
+}
+
+func decodeErrorDetail(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.Is(err, io.EOF):
+		return "body must not be empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "malformed JSON: unexpected end of body"
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("invalid value for field %q", typeErr.Field)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	default:
+		return err.Error()
+	}
+}
+
+func Write(w *response.Writer, statusCode response.StatusCode, v any) error {
+	return write(w, statusCode, jsonType, v)
+}
+
+func WriteProblem(w *response.Writer, p Problem) error {
+	if p.Status == 0 {
+		p.Status = response.InternalServerErrorStatus
+	}
+	return write(w, p.Status, problemType, p)
+}
+
+func WriteError(w *response.Writer, err error) error {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return WriteProblem(w, Problem{
+			Title:  response.ReasonPhrase(decodeErr.Status),
+			Status: decodeErr.Status,
+			Detail: decodeErr.Detail,
+		})
+	}
+	return WriteProblem(w, Problem{
+		Title:  response.ReasonPhrase(response.InternalServerErrorStatus),
+		Status: response.InternalServerErrorStatus,
+	})
+}
+
+func write(w *response.Writer, statusCode response.StatusCode, ctype string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding json response: %s", err.Error())
+	}
+
+	hdrs := response.GetDefaultHeaders(len(body))
+	hdrs.Set("Content-Type", ctype)
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(hdrs); err != nil {
+		return err
+	}
+	_, err = w.WriteBody(body)
+	return err
+}
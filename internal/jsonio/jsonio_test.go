@@ -0,0 +1,112 @@
+package jsonio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type coffee struct {
+	Name  string `json:"name"`
+	Shots int    `json:"shots"`
+}
+
+func jsonRequest(t *testing.T, ctype, body string) *request.Request {
+	t.Helper()
+	raw := fmt.Sprintf("POST /coffee HTTP/1.1\r\nHost: localhost:42069\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", ctype, len(body), body)
+	r, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return r
+}
+
+func readResponse(t *testing.T, out *bytes.Buffer) (*http.Response, []byte) {
+	t.Helper()
+	res, err := http.ReadResponse(bufio.NewReader(out), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, body
+}
+
+func TestDecode(t *testing.T) {
+	var c coffee
+	err := Decode(jsonRequest(t, "application/json; charset=utf-8", `{"name":"cortado","shots":2}`), &c, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, coffee{Name: "cortado", Shots: 2}, c)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		ctype, body string
+		status      response.StatusCode
+	}{
+		{"text/plain", `{"name":"x"}`, response.UnsupportedMediaTypeStatus},
+		{"application/json", `{"name":"` + strings.Repeat("x", 100) + `"}`, response.ContentTooLargeStatus},
+		{"application/json", `{"name":`, response.BadRequestStatus},
+		{"application/json", `{"name":"x","milk":true}`, response.BadRequestStatus},
+		{"application/json", `{"shots":"two"}`, response.BadRequestStatus},
+		{"application/json", `{"name":"x"}{"name":"y"}`, response.BadRequestStatus},
+		{"application/json", ``, response.BadRequestStatus},
+	}
+	for _, tc := range cases {
+		var c coffee
+		err := Decode(jsonRequest(t, tc.ctype, tc.body), &c, 64)
+		var decodeErr *DecodeError
+		require.ErrorAs(t, err, &decodeErr, tc.body)
+		assert.Equal(t, tc.status, decodeErr.Status, tc.body)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	require.NoError(t, Write(&w, response.OkStatus, coffee{Name: "latte", Shots: 1}))
+
+	res, body := readResponse(t, out)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"name":"latte","shots":1}`, string(body))
+}
+
+func TestWriteProblemFromDecodeError(t *testing.T) {
+	var c coffee
+	err := Decode(jsonRequest(t, "application/json", `{"milk":true}`), &c, 1024)
+	require.Error(t, err)
+
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	require.NoError(t, WriteError(&w, err))
+
+	res, body := readResponse(t, out)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal(body, &problem))
+	assert.Equal(t, "about:blank", problem["type"])
+	assert.Equal(t, "Bad Request", problem["title"])
+	assert.Equal(t, float64(400), problem["status"])
+	assert.Equal(t, `unknown field "milk"`, problem["detail"])
+}
+
+func TestProblemExtensions(t *testing.T) {
+	data, err := json.Marshal(Problem{
+		Type:       "https://example.com/probs/out-of-credit",
+		Title:      "You do not have enough credit.",
+		Status:     403,
+		Instance:   "/account/12345/msgs/abc",
+		Extensions: map[string]any{"balance": 30},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"https://example.com/probs/out-of-credit","title":"You do not have enough credit.","status":403,"instance":"/account/12345/msgs/abc","balance":30}`, string(data))
+}
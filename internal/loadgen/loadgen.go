@@ -0,0 +1,342 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/headers"
+)
+
+const defaultTimeout = 10 * time.Second
+
+type Config struct {
+	Request     *client.Request
+	Connections int
+	Duration    time.Duration
+	// Rate is the number of requests per second across all connections. When
+	// every connection is busy at a tick the request is counted as missed
+	// rather than queued. Zero sends as fast as the server answers.
+	Rate float64
+	// KeepAlive reuses each connection for as long as the server allows;
+	// otherwise every request opens a new one and asks for it to be closed.
+	KeepAlive bool
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+}
+
+type Result struct {
+	Elapsed   time.Duration
+	Requests  int
+	Dials     int
+	Missed    int
+	BodyBytes int64
+	// Latencies are sorted, and include the dial for requests that needed a
+	// new connection.
+	Latencies []time.Duration
+	Statuses  map[int]int
+	Errors    map[string]int
+}
+
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	if cfg.Request == nil {
+		return nil, errors.New("no request configured")
+	}
+	if cfg.Connections <= 0 {
+		return nil, fmt.Errorf("invalid number of connections: %d", cfg.Connections)
+	}
+	if cfg.Rate < 0 {
+		return nil, fmt.Errorf("invalid rate: %v", cfg.Rate)
+	}
+	req := cfg.Request
+	if !cfg.KeepAlive {
+		r2 := *req
+		r2.Headers = cloneHeaders(req)
+		r2.Headers.Set("Connection", "close")
+		req = &r2
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	var tokens chan struct{}
+	var missed int
+	var tickerDone sync.WaitGroup
+	if cfg.Rate > 0 {
+		tokens = make(chan struct{}, cfg.Connections)
+		tickerDone.Add(1)
+		go func() {
+			defer tickerDone.Done()
+			missed = tick(ctx, cfg.Rate, tokens)
+		}()
+	}
+
+	start := time.Now()
+	results := make([]*Result, cfg.Connections)
+	var wg sync.WaitGroup
+	for i := range results {
+		results[i] = newResult()
+		w := &worker{cfg: cfg, req: req, tokens: tokens, res: results[i]}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+		}()
+	}
+	wg.Wait()
+	tickerDone.Wait()
+
+	total := newResult()
+	total.Elapsed = time.Since(start)
+	total.Missed = missed
+	for _, r := range results {
+		total.Requests += r.Requests
+		total.Dials += r.Dials
+		total.BodyBytes += r.BodyBytes
+		total.Latencies = append(total.Latencies, r.Latencies...)
+		for status, n := range r.Statuses {
+			total.Statuses[status] += n
+		}
+		for kind, n := range r.Errors {
+			total.Errors[kind] += n
+		}
+	}
+	sort.Slice(total.Latencies, func(a, b int) bool { return total.Latencies[a] < total.Latencies[b] })
+	return total, nil
+}
+
+func newResult() *Result {
+	return &Result{Statuses: make(map[int]int), Errors: make(map[string]int)}
+}
+
+func cloneHeaders(req *client.Request) headers.Headers {
+	out := headers.NewHeaders()
+	for key, val := range req.Headers {
+		out[key] = val
+	}
+	return out
+}
+
+func tick(ctx context.Context, rate float64, tokens chan<- struct{}) int {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return missed
+		case <-ticker.C:
+			select {
+			case tokens <- struct{}{}:
+			default:
+				missed++
+			}
+		}
+	}
+}
+
+type worker struct {
+	cfg    Config
+	req    *client.Request
+	tokens <-chan struct{}
+	res    *Result
+	conn   net.Conn
+	br     *bufio.Reader
+}
+
+func (w *worker) run(ctx context.Context) {
+	defer w.closeConn()
+	for {
+		if w.tokens != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.tokens:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		w.send()
+	}
+}
+
+func (w *worker) send() {
+	start := time.Now()
+	timeout := w.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if w.conn == nil {
+		if err := w.dial(timeout); err != nil {
+			w.res.Errors["dial: "+classify(err)]++
+			return
+		}
+	}
+	w.conn.SetDeadline(start.Add(timeout))
+
+	if err := w.req.Write(w.conn); err != nil {
+		w.fail("write", err)
+		return
+	}
+	res, err := client.ReadResponse(w.br, w.req.Method)
+	if err != nil {
+		w.fail("read", err)
+		return
+	}
+	n, err := io.Copy(io.Discard, res.Body)
+	if err != nil {
+		w.fail("read body", err)
+		return
+	}
+
+	w.res.Requests++
+	w.res.BodyBytes += n
+	w.res.Latencies = append(w.res.Latencies, time.Since(start))
+	w.res.Statuses[int(res.StatusCode)]++
+	if !w.cfg.KeepAlive || res.Close {
+		w.closeConn()
+	}
+}
+
+func (w *worker) dial(timeout time.Duration) error {
+	u := w.req.URL
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "https" {
+		cfg := &tls.Config{}
+		if w.cfg.TLSConfig != nil {
+			cfg = w.cfg.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		conn = tls.Client(conn, cfg)
+	}
+	w.res.Dials++
+	w.conn = conn
+	w.br = bufio.NewReader(conn)
+	return nil
+}
+
+func (w *worker) fail(stage string, err error) {
+	w.res.Errors[stage+": "+classify(err)]++
+	w.closeConn()
+}
+
+func (w *worker) closeConn() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+func classify(err error) string {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return "connection reset"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection closed"
+	case errors.Is(err, client.ErrMalformedResponse):
+		return "malformed response"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "other"
+}
+
+// Percentile uses the nearest-rank method on the sorted latencies.
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(r.Latencies))))
+	return r.Latencies[min(max(rank, 1), len(r.Latencies))-1]
+}
+
+func (r *Result) Failed() int {
+	failed := 0
+	for _, n := range r.Errors {
+		failed += n
+	}
+	return failed
+}
+
+func (r *Result) Report(w io.Writer) {
+	seconds := r.Elapsed.Seconds()
+	fmt.Fprintf(w, "Requests:    %d completed, %d failed, %d connections opened\n", r.Requests, r.Failed(), r.Dials)
+	if r.Missed > 0 {
+		fmt.Fprintf(w, "Missed:      %d requests (every connection was busy when they were due)\n", r.Missed)
+	}
+	if seconds > 0 {
+		fmt.Fprintf(w, "Throughput:  %.1f req/s, %.1f KB/s of body\n", float64(r.Requests)/seconds, float64(r.BodyBytes)/1024/seconds)
+	}
+	if len(r.Latencies) > 0 {
+		fmt.Fprintf(w, "Latency:     p50 %s  p90 %s  p99 %s  max %s\n",
+			round(r.Percentile(50)), round(r.Percentile(90)), round(r.Percentile(99)), round(r.Latencies[len(r.Latencies)-1]))
+	}
+
+	if len(r.Statuses) > 0 {
+		codes := make([]int, 0, len(r.Statuses))
+		for code := range r.Statuses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		parts := make([]string, 0, len(codes))
+		for _, code := range codes {
+			parts = append(parts, fmt.Sprintf("%d: %d", code, r.Statuses[code]))
+		}
+		fmt.Fprintf(w, "Status:      %s\n", strings.Join(parts, ", "))
+	}
+
+	if len(r.Errors) > 0 {
+		kinds := make([]string, 0, len(r.Errors))
+		for kind := range r.Errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		sort.SliceStable(kinds, func(a, b int) bool { return r.Errors[kinds[a]] > r.Errors[kinds[b]] })
+		fmt.Fprintln(w, "Errors:")
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "  %-28s %d\n", kind, r.Errors[kind])
+		}
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,189 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, url string) *client.Request {
+	t.Helper()
+	req, err := client.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	return req
+}
+
+func startServer(t *testing.T, handler server.Handler) string {
+	t.Helper()
+	srv, err := server.Serve(0, handler)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return fmt.Sprintf("http://127.0.0.1:%d/", srv.Addr().(*net.TCPAddr).Port)
+}
+
+// startKeepAliveServer answers every request on a connection until the
+// client closes it, since the project's server closes after one response.
+func startKeepAliveServer(t *testing.T, status response.StatusCode) (string, *atomic.Int64) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	var conns atomic.Int64
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conn.Close()
+				for {
+					rq, err := request.RequestFromReader(conn)
+					if err != nil || rq.RequestLine.Method == "" {
+						return
+					}
+					w := response.NewWriter(conn)
+					w.WriteStatusLine(status)
+					hdrs := response.GetDefaultHeaders(2)
+					hdrs.Set("Connection", "keep-alive")
+					w.WriteHeaders(hdrs)
+					w.WriteBody([]byte("ok"))
+				}
+			}()
+		}
+	}()
+	return "http://" + listener.Addr().String() + "/", &conns
+}
+
+func TestRunKeepAlive(t *testing.T) {
+	url, conns := startKeepAliveServer(t, response.OkStatus)
+	res, err := Run(context.Background(), Config{
+		Request:     newRequest(t, url),
+		Connections: 4,
+		Duration:    200 * time.Millisecond,
+		KeepAlive:   true,
+	})
+	require.NoError(t, err)
+	assert.Greater(t, res.Requests, 4)
+	assert.Equal(t, map[int]int{200: res.Requests}, res.Statuses)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 4, res.Dials)
+	assert.EqualValues(t, 4, conns.Load())
+	assert.Equal(t, int64(2*res.Requests), res.BodyBytes)
+	assert.Len(t, res.Latencies, res.Requests)
+}
+
+func TestRunOneShot(t *testing.T) {
+	var closes atomic.Int64
+	url := startServer(t, func(w *response.Writer, r *request.Request) {
+		if c, _ := r.Headers.Get("Connection"); c == "close" {
+			closes.Add(1)
+		}
+		w.WriteStatusLine(response.NotFoundStatus)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		w.WriteBody(nil)
+	})
+	res, err := Run(context.Background(), Config{
+		Request:     newRequest(t, url),
+		Connections: 2,
+		Duration:    100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Greater(t, res.Requests, 0)
+	assert.Equal(t, res.Requests, res.Dials)
+	assert.Equal(t, map[int]int{404: res.Requests}, res.Statuses)
+	assert.EqualValues(t, res.Requests, closes.Load())
+}
+
+func TestRunFixedRate(t *testing.T) {
+	url, _ := startKeepAliveServer(t, response.OkStatus)
+	res, err := Run(context.Background(), Config{
+		Request:     newRequest(t, url),
+		Connections: 2,
+		Duration:    500 * time.Millisecond,
+		Rate:        40,
+		KeepAlive:   true,
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 20, res.Requests, 6)
+}
+
+func TestRunCountsErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	res, err := Run(context.Background(), Config{
+		Request:     newRequest(t, "http://"+addr+"/"),
+		Connections: 1,
+		Duration:    50 * time.Millisecond,
+		Rate:        100,
+	})
+	require.NoError(t, err)
+	assert.Zero(t, res.Requests)
+	assert.Greater(t, res.Errors["dial: connection refused"], 0)
+	assert.Equal(t, res.Failed(), res.Errors["dial: connection refused"])
+
+	garbage, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer garbage.Close()
+	go func() {
+		for {
+			conn, err := garbage.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH\r\n"))
+			conn.Close()
+		}
+	}()
+	res, err = Run(context.Background(), Config{
+		Request:     newRequest(t, "http://"+garbage.Addr().String()+"/"),
+		Connections: 1,
+		Duration:    50 * time.Millisecond,
+		Rate:        100,
+	})
+	require.NoError(t, err)
+	assert.Greater(t, res.Errors["read: malformed response"], 0)
+}
+
+func TestPercentileAndReport(t *testing.T) {
+	res := newResult()
+	for i := 1; i <= 100; i++ {
+		res.Latencies = append(res.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	res.Requests = 100
+	res.Elapsed = 2 * time.Second
+	res.Statuses[200] = 90
+	res.Statuses[503] = 10
+	res.Errors["read: timeout"] = 3
+	res.Errors["dial: connection refused"] = 5
+
+	assert.Equal(t, 50*time.Millisecond, res.Percentile(50))
+	assert.Equal(t, 90*time.Millisecond, res.Percentile(90))
+	assert.Equal(t, 99*time.Millisecond, res.Percentile(99))
+	assert.Equal(t, 100*time.Millisecond, res.Percentile(100))
+	assert.Zero(t, newResult().Percentile(50))
+
+	var out strings.Builder
+	res.Report(&out)
+	report := out.String()
+	assert.Contains(t, report, "100 completed, 8 failed")
+	assert.Contains(t, report, "50.0 req/s")
+	assert.Contains(t, report, "p50 50ms  p90 90ms  p99 99ms  max 100ms")
+	assert.Contains(t, report, "200: 90, 503: 10")
+	assert.Less(t, strings.Index(report, "connection refused"), strings.Index(report, "timeout"))
+}
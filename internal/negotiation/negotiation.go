@@ -0,0 +1,175 @@
+package negotiation
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+type Spec struct {
+	Value  string
+	Params map[string]string
+	Q      float64
+}
+
+func ParseAccept(header string) []Spec {
+	var specs []Spec
+	for _, part := range splitList(header) {
+		fields := strings.Split(part, ";")
+		spec := Spec{
+			Value:  strings.ToLower(strings.TrimSpace(fields[0])),
+			Params: make(map[string]string),
+			Q:      1,
+		}
+		if spec.Value == "" {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			key = strings.ToLower(strings.TrimSpace(key))
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			if key == "q" {
+				q, err := strconv.ParseFloat(val, 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				spec.Q = q
+				continue
+			}
+			spec.Params[key] = val
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func ContentType(r *request.Request, offers []string) (string, bool) {
+	header, ok := r.Headers.Get("Accept")
+	if !ok {
+		return firstOffer(offers)
+	}
+	return best(ParseAccept(header), offers, mediaTypeMatch)
+}
+
+func Language(r *request.Request, offers []string) (string, bool) {
+	header, ok := r.Headers.Get("Accept-Language")
+	if !ok {
+		return firstOffer(offers)
+	}
+	return best(ParseAccept(header), offers, languageMatch)
+}
+
+func Charset(r *request.Request, offers []string) (string, bool) {
+	header, ok := r.Headers.Get("Accept-Charset")
+	if !ok {
+		return firstOffer(offers)
+	}
+	return best(ParseAccept(header), offers, tokenMatch)
+}
+
+func NotAcceptable(w *response.Writer, offers []string) {
+	server.HandlerError{
+		StatusCode: response.NotAcceptableStatus,
+		Message:    "not acceptable, available: " + strings.Join(offers, ", "),
+	}.Write(w)
+}
+
+type matchFunc func(spec Spec, offer string) (specificity int, ok bool)
+
+func best(specs []Spec, offers []string, match matchFunc) (string, bool) {
+	bestOffer, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, spec := range specs {
+			s, ok := match(spec, offer)
+			if ok && s > specificity {
+				q, specificity = spec.Q, s
+			}
+		}
+		if q > bestQ {
+			bestOffer, bestQ = offer, q
+		}
+	}
+	return bestOffer, bestQ > 0
+}
+
+func mediaTypeMatch(spec Spec, offer string) (int, bool) {
+	offerSpecs := ParseAccept(offer)
+	if len(offerSpecs) == 0 {
+		return 0, false
+	}
+	o := offerSpecs[0]
+
+	specType, specSub, _ := strings.Cut(spec.Value, "/")
+	offerType, offerSub, _ := strings.Cut(o.Value, "/")
+	switch {
+	case specType == "*" && specSub == "*":
+		return 0, true
+	case specType != offerType:
+		return 0, false
+	case specSub == "*":
+		return 1, true
+	case specSub != offerSub:
+		return 0, false
+	}
+
+	for key, val := range spec.Params {
+		if !strings.EqualFold(o.Params[key], val) {
+			return 0, false
+		}
+	}
+	return 2 + len(spec.Params), true
+}
+
+func languageMatch(spec Spec, offer string) (int, bool) {
+	offer = strings.ToLower(offer)
+	switch {
+	case spec.Value == "*":
+		return 0, true
+	case spec.Value == offer:
+		return 2, true
+	case strings.HasPrefix(offer, spec.Value+"-"):
+		return 1, true
+	}
+	return 0, false
+}
+
+func tokenMatch(spec Spec, offer string) (int, bool) {
+	if spec.Value == "*" {
+		return 0, true
+	}
+	return 1, strings.EqualFold(spec.Value, offer)
+}
+
+func firstOffer(offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	return offers[0], true
+}
+
+func splitList(header string) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, r := range header {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ',' && !inQuotes:
+			parts = append(parts, header[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, header[start:])
+	return slices.DeleteFunc(parts, func(p string) bool {
+		return strings.TrimSpace(p) == ""
+	})
+}
@@ -0,0 +1,82 @@
+package negotiation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, hdrs string) *request.Request {
+	t.Helper()
+	r, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n" + hdrs + "\r\n"))
+	require.NoError(t, err)
+	return r
+}
+
+func TestParseAccept(t *testing.T) {
+	specs := ParseAccept(`text/html;level=1, application/json;q=0.5, text/plain; charset="utf-8"; q=0.2`)
+	require.Len(t, specs, 3)
+	assert.Equal(t, "text/html", specs[0].Value)
+	assert.Equal(t, "1", specs[0].Params["level"])
+	assert.Equal(t, 1.0, specs[0].Q)
+	assert.Equal(t, 0.5, specs[1].Q)
+	assert.Equal(t, "utf-8", specs[2].Params["charset"])
+	assert.Equal(t, 0.2, specs[2].Q)
+}
+
+func TestContentType(t *testing.T) {
+	offers := []string{"text/html", "application/json", "text/plain"}
+
+	ctype, ok := ContentType(newRequest(t, "Accept: application/json\r\n"), offers)
+	require.True(t, ok)
+	assert.Equal(t, "application/json", ctype)
+
+	ctype, ok = ContentType(newRequest(t, "Accept: text/*;q=0.5, application/json;q=0.4\r\n"), offers)
+	require.True(t, ok)
+	assert.Equal(t, "text/html", ctype)
+
+	ctype, ok = ContentType(newRequest(t, "Accept: text/*, text/html;q=0\r\n"), offers)
+	require.True(t, ok)
+	assert.Equal(t, "text/plain", ctype)
+
+	ctype, ok = ContentType(newRequest(t, ""), offers)
+	require.True(t, ok)
+	assert.Equal(t, "text/html", ctype)
+
+	_, ok = ContentType(newRequest(t, "Accept: image/png\r\n"), offers)
+	assert.False(t, ok)
+}
+
+func TestMediaTypeParams(t *testing.T) {
+	offers := []string{"text/html;level=2", "text/html;level=1"}
+	ctype, ok := ContentType(newRequest(t, "Accept: text/html;level=1\r\n"), offers)
+	require.True(t, ok)
+	assert.Equal(t, "text/html;level=1", ctype)
+}
+
+func TestLanguageAndCharset(t *testing.T) {
+	lang, ok := Language(newRequest(t, "Accept-Language: fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5\r\n"), []string{"en-US", "es", "fr"})
+	require.True(t, ok)
+	assert.Equal(t, "fr", lang)
+
+	lang, ok = Language(newRequest(t, "Accept-Language: de, *;q=0.1\r\n"), []string{"es", "en"})
+	require.True(t, ok)
+	assert.Equal(t, "es", lang)
+
+	charset, ok := Charset(newRequest(t, "Accept-Charset: iso-8859-1;q=0.5, UTF-8\r\n"), []string{"iso-8859-1", "utf-8"})
+	require.True(t, ok)
+	assert.Equal(t, "utf-8", charset)
+}
+
+func TestNotAcceptable(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	NotAcceptable(&w, []string{"application/json"})
+	assert.True(t, strings.HasPrefix(out.String(), "HTTP/1.1 406 Not Acceptable\r\n"))
+	assert.Contains(t, out.String(), "application/json")
+}
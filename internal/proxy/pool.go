@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/request"
+)
+
+type Strategy int
+
+const (
+	RoundRobin Strategy = iota
+	LeastConnections
+	ConsistentHash
+)
+
+const (
+	defaultMaxFailures    = 3
+	defaultEjectDuration  = 30 * time.Second
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+	virtualNodes          = 100
+)
+
+type Backend struct {
+	url          *url.URL
+	active       atomic.Int64
+	failures     atomic.Int64
+	ejectedUntil atomic.Int64
+	checkFailed  atomic.Bool
+}
+
+func (b *Backend) URL() *url.URL {
+	return b.url
+}
+
+func (b *Backend) ActiveConnections() int64 {
+	return b.active.Load()
+}
+
+func (b *Backend) Healthy() bool {
+	return !b.checkFailed.Load() && time.Now().UnixNano() >= b.ejectedUntil.Load()
+}
+
+type ringNode struct {
+	hash    uint32
+	backend *Backend
+}
+
+type Pool struct {
+	Strategy Strategy
+	// HashHeader names the request header hashed by ConsistentHash; the
+	// client address is used when it is empty or missing from the request.
+	HashHeader     string
+	HealthPath     string
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+	MaxFailures    int
+	EjectDuration  time.Duration
+
+	backends []*Backend
+	ring     []ringNode
+	next     atomic.Uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewPool(strategy Strategy, upstreams ...string) (*Pool, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("upstream pool needs at least one backend")
+	}
+	p := &Pool{
+		Strategy:       strategy,
+		HealthInterval: defaultHealthInterval,
+		HealthTimeout:  defaultHealthTimeout,
+		MaxFailures:    defaultMaxFailures,
+		EjectDuration:  defaultEjectDuration,
+		stop:           make(chan struct{}),
+	}
+	for _, upstream := range upstreams {
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid upstream url: %s", upstream)
+		}
+		b := &Backend{url: u}
+		p.backends = append(p.backends, b)
+		for i := range virtualNodes {
+			key := u.String() + "#" + strconv.Itoa(i)
+			p.ring = append(p.ring, ringNode{hash: crc32.ChecksumIEEE([]byte(key)), backend: b})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	return p, nil
+}
+
+func (p *Pool) Backends() []*Backend {
+	return p.backends
+}
+
+func (p *Pool) Pick(r *request.Request, exclude []*Backend) *Backend {
+	usable := func(b *Backend) bool {
+		return b.Healthy() && !slices.Contains(exclude, b)
+	}
+
+	switch p.Strategy {
+	case LeastConnections:
+		var best *Backend
+		start := int(p.next.Add(1))
+		for i := range p.backends {
+			b := p.backends[(start+i)%len(p.backends)]
+			if usable(b) && (best == nil || b.ActiveConnections() < best.ActiveConnections()) {
+				best = b
+			}
+		}
+		return best
+	case ConsistentHash:
+		sum := crc32.ChecksumIEEE([]byte(p.hashKey(r)))
+		start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= sum })
+		for i := range p.ring {
+			b := p.ring[(start+i)%len(p.ring)].backend
+			if usable(b) {
+				return b
+			}
+		}
+		return nil
+	default:
+		start := int(p.next.Add(1) - 1)
+		for i := range p.backends {
+			b := p.backends[(start+i)%len(p.backends)]
+			if usable(b) {
+				return b
+			}
+		}
+		return nil
+	}
+}
+
+func (p *Pool) hashKey(r *request.Request) string {
+	if p.HashHeader != "" {
+		if val, ok := r.Headers.Get(p.HashHeader); ok {
+			return val
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (p *Pool) reportSuccess(b *Backend) {
+	b.failures.Store(0)
+}
+
+func (p *Pool) reportFailure(b *Backend) {
+	maxFailures := p.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFailures
+	}
+	if b.failures.Add(1) < int64(maxFailures) {
+		return
+	}
+	eject := p.EjectDuration
+	if eject <= 0 {
+		eject = defaultEjectDuration
+	}
+	b.failures.Store(0)
+	b.ejectedUntil.Store(time.Now().Add(eject).UnixNano())
+}
+
+func (p *Pool) StartHealthChecks() {
+	if p.HealthPath == "" {
+		return
+	}
+	interval := p.HealthInterval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.CheckHealth()
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Pool) CheckHealth() {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.checkFailed.Store(!p.probe(b))
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pool) probe(b *Backend) bool {
+	timeout := p.HealthTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	target := *b.url
+	target.Path = joinPaths(b.url.Path, p.HealthPath)
+	target.RawQuery = ""
+	req, err := client.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return false
+	}
+	res, err := client.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode >= 200 && res.StatusCode < 400
+}
+
+func (p *Pool) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func namedBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func closedURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	return "http://" + addr
+}
+
+func startPoolProxy(t *testing.T, pool *Pool) string {
+	t.Helper()
+	srv, err := server.Serve(0, NewPoolProxy(pool).Handle)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return fmt.Sprintf("127.0.0.1:%d", srv.Addr().(*net.TCPAddr).Port)
+}
+
+func fetch(t *testing.T, addr, method, extraHeaders string) (int, string) {
+	t.Helper()
+	res := roundTrip(t, addr, method+" / HTTP/1.1\r\nHost: front.test\r\n"+extraHeaders+"\r\n")
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res.StatusCode, string(body)
+}
+
+func newRequest(t *testing.T, raw string) *request.Request {
+	t.Helper()
+	r, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	r.RemoteAddr = "10.0.0.1:1234"
+	return r
+}
+
+func TestRoundRobin(t *testing.T) {
+	a, b := namedBackend(t, "a"), namedBackend(t, "b")
+	pool, err := NewPool(RoundRobin, a.URL, b.URL)
+	require.NoError(t, err)
+	addr := startPoolProxy(t, pool)
+
+	var got []string
+	for range 4 {
+		_, body := fetch(t, addr, "GET", "")
+		got = append(got, body)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, got)
+}
+
+func TestLeastConnections(t *testing.T) {
+	pool, err := NewPool(LeastConnections, "http://a.test", "http://b.test", "http://c.test")
+	require.NoError(t, err)
+	backends := pool.Backends()
+	backends[0].active.Store(3)
+	backends[1].active.Store(1)
+	backends[2].active.Store(2)
+
+	r := newRequest(t, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	for range 3 {
+		assert.Same(t, backends[1], pool.Pick(r, nil))
+	}
+	assert.Same(t, backends[2], pool.Pick(r, []*Backend{backends[1]}))
+}
+
+func TestConsistentHash(t *testing.T) {
+	pool, err := NewPool(ConsistentHash, "http://a.test", "http://b.test", "http://c.test")
+	require.NoError(t, err)
+	pool.HashHeader = "X-User"
+
+	counts := map[*Backend]int{}
+	for i := range 60 {
+		r := newRequest(t, fmt.Sprintf("GET / HTTP/1.1\r\nHost: x\r\nX-User: user-%d\r\n\r\n", i))
+		first := pool.Pick(r, nil)
+		assert.Same(t, first, pool.Pick(r, nil))
+		counts[first]++
+	}
+	assert.Len(t, counts, 3)
+
+	r := newRequest(t, "GET / HTTP/1.1\r\nHost: x\r\nX-User: sticky\r\n\r\n")
+	owner := pool.Pick(r, nil)
+	owner.ejectedUntil.Store(time.Now().Add(time.Minute).UnixNano())
+	moved := pool.Pick(r, nil)
+	assert.NotSame(t, owner, moved)
+	owner.ejectedUntil.Store(0)
+	assert.Same(t, owner, pool.Pick(r, nil))
+}
+
+func TestRetryAndPassiveEjection(t *testing.T) {
+	good := namedBackend(t, "good")
+	pool, err := NewPool(RoundRobin, closedURL(t), good.URL)
+	require.NoError(t, err)
+	pool.MaxFailures = 2
+	addr := startPoolProxy(t, pool)
+
+	for range 4 {
+		status, body := fetch(t, addr, "GET", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "good", body)
+	}
+	assert.False(t, pool.Backends()[0].Healthy())
+
+	pool.Backends()[0].ejectedUntil.Store(0)
+	pool.next.Store(0)
+	status, _ := fetch(t, addr, "POST", "Content-Length: 0\r\n")
+	assert.Equal(t, http.StatusBadGateway, status)
+}
+
+func TestActiveHealthChecks(t *testing.T) {
+	var healthy atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "flaky")
+	}))
+	defer flaky.Close()
+
+	pool, err := NewPool(RoundRobin, flaky.URL)
+	require.NoError(t, err)
+	pool.HealthPath = "/healthz"
+	addr := startPoolProxy(t, pool)
+
+	pool.CheckHealth()
+	status, _ := fetch(t, addr, "GET", "")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	healthy.Store(true)
+	pool.CheckHealth()
+	status, body := fetch(t, addr, "GET", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "flaky", body)
+}
+
+func TestPoolAnswersWhenClientGoesAway(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	pool, err := NewPool(RoundRobin, slow.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	r := newRequest(t, "GET / HTTP/1.1\r\nHost: front.test\r\n\r\n").WithContext(ctx)
+	var out bytes.Buffer
+	w := response.NewWriter(&out)
+	NewPoolProxy(pool).Handle(&w, r)
+
+	assert.True(t, strings.HasPrefix(out.String(), "HTTP/1.1 502 Bad Gateway\r\n"))
+	assert.Zero(t, pool.Backends()[0].ActiveConnections())
+	assert.True(t, pool.Backends()[0].Healthy())
+}
+
+func TestPoolZeroDurationsUseDefaults(t *testing.T) {
+	good := namedBackend(t, "good")
+	pool, err := NewPool(RoundRobin, good.URL)
+	require.NoError(t, err)
+	defer pool.Close()
+	pool.HealthPath = "/healthz"
+	pool.HealthInterval = 0
+	pool.HealthTimeout = -time.Second
+	pool.EjectDuration = 0
+	pool.MaxFailures = 1
+
+	require.NotPanics(t, pool.StartHealthChecks)
+	pool.CheckHealth()
+	assert.True(t, pool.Backends()[0].Healthy())
+
+	pool.reportFailure(pool.Backends()[0])
+	assert.False(t, pool.Backends()[0].Healthy())
+}
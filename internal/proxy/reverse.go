@@ -0,0 +1,362 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/client"
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+const defaultTimeout = 30 * time.Second
+
+var errUpstreamTimeout = errors.New("proxy: upstream timed out")
+
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type ReverseProxy struct {
+	Upstream    *url.URL
+	Pool        *Pool
+	StripPrefix string
+	Client      *client.Client
+	// Timeout bounds the wait for the upstream response headers; the body
+	// is streamed for as long as the client stays connected.
+	Timeout time.Duration
+}
+
+func NewReverseProxy(upstream string) (*ReverseProxy, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream url: %s", err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream url: %s", upstream)
+	}
+	return &ReverseProxy{
+		Upstream: u,
+		Client:   &client.Client{},
+		Timeout:  defaultTimeout,
+	}, nil
+}
+
+func NewPoolProxy(pool *Pool) *ReverseProxy {
+	return &ReverseProxy{
+		Pool:    pool,
+		Client:  &client.Client{},
+		Timeout: defaultTimeout,
+	}
+}
+
+func (p *ReverseProxy) Handle(w *response.Writer, r *request.Request) {
+	in, err := requestURL(r, p.StripPrefix)
+	if err != nil {
+		server.HandlerError{StatusCode: response.BadRequestStatus, Message: err.Error()}.Write(w)
+		return
+	}
+
+	if p.Pool == nil {
+		res, err := p.roundTrip(r, p.Upstream, in)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		defer res.Body.Close()
+		copyResponse(w, res, r.RequestLine.Method == "HEAD")
+		return
+	}
+
+	var tried []*Backend
+	for {
+		backend := p.Pool.Pick(r, tried)
+		if backend == nil {
+			msg := "no healthy upstream\n"
+			server.HandlerError{StatusCode: response.ServiceUnavailableStatus, Message: msg}.Write(w)
+			return
+		}
+		tried = append(tried, backend)
+		if !p.forward(w, r, in, backend, len(tried)) {
+			return
+		}
+	}
+}
+
+// forward proxies r to backend and reports whether the caller should retry
+// with another one. Once it returns false the response has been written.
+func (p *ReverseProxy) forward(w *response.Writer, r *request.Request, in *url.URL, backend *Backend, attempts int) bool {
+	backend.active.Add(1)
+	defer backend.active.Add(-1)
+
+	res, err := p.roundTrip(r, backend.url, in)
+	if err != nil {
+		// A client that went away says nothing about the backend.
+		if r.Context().Err() == nil {
+			p.Pool.reportFailure(backend)
+			if idempotent(r.RequestLine.Method) && attempts < len(p.Pool.backends) {
+				return true
+			}
+		}
+		writeUpstreamError(w, err)
+		return false
+	}
+	defer res.Body.Close()
+	p.Pool.reportSuccess(backend)
+	copyResponse(w, res, r.RequestLine.Method == "HEAD")
+	return false
+}
+
+func (p *ReverseProxy) roundTrip(r *request.Request, upstream, in *url.URL) (*client.Response, error) {
+	outreq, err := outgoingRequest(r, upstream, in)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(r.Context())
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	timer := time.AfterFunc(timeout, func() { cancel(errUpstreamTimeout) })
+	res, err := p.Client.Do(outreq.WithContext(ctx))
+	timer.Stop()
+	if err != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, errUpstreamTimeout) {
+			err = cause
+		}
+		cancel(nil)
+		return nil, err
+	}
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: func() { cancel(nil) }}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func requestURL(r *request.Request, stripPrefix string) (*url.URL, error) {
+	target := r.RequestLine.RequestTarget
+	if stripPrefix != "" {
+		target = strings.TrimPrefix(target, stripPrefix)
+	}
+	if !strings.HasPrefix(target, "/") {
+		target = "/" + target
+	}
+	in, err := url.ParseRequestURI(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request target: %s", r.RequestLine.RequestTarget)
+	}
+	return in, nil
+}
+
+func outgoingRequest(r *request.Request, upstream, in *url.URL) (*client.Request, error) {
+	out := *upstream
+	out.Path = joinPaths(upstream.Path, in.Path)
+	out.RawPath = ""
+	out.RawQuery = in.RawQuery
+	if upstream.RawQuery != "" && in.RawQuery != "" {
+		out.RawQuery = upstream.RawQuery + "&" + in.RawQuery
+	} else if upstream.RawQuery != "" {
+		out.RawQuery = upstream.RawQuery
+	}
+
+	outreq, err := client.NewRequest(r.RequestLine.Method, out.String(), r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("building upstream request: %s", err.Error())
+	}
+	for key, val := range withoutHopByHop(r.Headers) {
+		if strings.EqualFold(key, "Host") {
+			continue
+		}
+		outreq.Headers.Set(key, val)
+	}
+	addForwardedHeaders(outreq.Headers, r)
+	return outreq, nil
+}
+
+func addForwardedHeaders(h headers.Headers, r *request.Request) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	host, _ := r.Headers.Get("Host")
+
+	if clientIP != "" {
+		if prior, ok := h.Get("X-Forwarded-For"); ok && prior != "" {
+			h.Set("X-Forwarded-For", prior, clientIP)
+		} else {
+			h.Set("X-Forwarded-For", clientIP)
+		}
+	}
+	if host != "" {
+		h.Set("X-Forwarded-Host", host)
+	}
+	h.Set("X-Forwarded-Proto", "http")
+
+	var elem []string
+	if clientIP != "" {
+		elem = append(elem, "for="+forwardedNode(clientIP))
+	}
+	if host != "" {
+		elem = append(elem, "host="+quoteForwarded(host))
+	}
+	elem = append(elem, "proto=http")
+	forwarded := strings.Join(elem, ";")
+	if prior, ok := h.Get("Forwarded"); ok && prior != "" {
+		forwarded = prior + ", " + forwarded
+	}
+	h.Set("Forwarded", forwarded)
+}
+
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+func quoteForwarded(v string) string {
+	if strings.ContainsAny(v, ":[]\"; ,=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func copyResponse(w *response.Writer, res *client.Response, isHead bool) {
+	trailerNames, _ := res.Headers.Get("Trailer")
+	for _, line := range res.SetCookies {
+		w.AddSetCookieLine(line)
+	}
+	hdrs := withoutHopByHop(res.Headers)
+	hdrs.Remove("Set-Cookie")
+	hdrs.Set("Connection", "close")
+
+	w.WriteStatusLine(res.StatusCode)
+	if isHead || res.StatusCode == 204 || res.StatusCode == 304 {
+		w.WriteHeaders(hdrs)
+		w.WriteEmptyBody()
+		return
+	}
+	if res.ContentLength >= 0 {
+		hdrs.Set("Content-Length", strconv.FormatInt(res.ContentLength, 10))
+		w.WriteHeaders(hdrs)
+		w.WriteBodyFrom(res.Body)
+		return
+	}
+
+	buf := make([]byte, 32*1024)
+	n, err := res.Body.Read(buf)
+	if n == 0 && errors.Is(err, io.EOF) {
+		hdrs.Set("Content-Length", "0")
+		w.WriteHeaders(hdrs)
+		w.WriteBody(nil)
+		return
+	}
+
+	hdrs.Remove("Content-Length")
+	hdrs.Set("Transfer-Encoding", "chunked")
+	if trailerNames != "" {
+		hdrs.Set("Trailer", trailerNames)
+	}
+	w.WriteHeaders(hdrs)
+	for {
+		if n > 0 {
+			if _, werr := w.WriteChunkedBody(buf[:n]); werr != nil {
+				return
+			}
+			if werr := w.Flush(); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			break
+		}
+		n, err = res.Body.Read(buf)
+	}
+	if !errors.Is(err, io.EOF) {
+		// The status line is already out, so the only way to signal the
+		// broken upstream body is to not terminate the chunked stream.
+		return
+	}
+
+	if len(res.Trailers) > 0 {
+		w.WriteTrailers(res.Trailers)
+		return
+	}
+	w.WriteChunkedBodyDone()
+}
+
+func withoutHopByHop(h headers.Headers) headers.Headers {
+	out := headers.NewHeaders()
+	for key, val := range h {
+		out[key] = val
+	}
+	if connection, ok := h.Get("Connection"); ok {
+		for _, name := range strings.Split(connection, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				out.Remove(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		out.Remove(name)
+	}
+	return out
+}
+
+func writeUpstreamError(w *response.Writer, err error) {
+	var netErr net.Error
+	status := response.BadGatewayStatus
+	if errors.Is(err, errUpstreamTimeout) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		status = response.GatewayTimeoutStatus
+	}
+	msg := response.ReasonPhrase(status) + "\n"
+	server.HandlerError{StatusCode: status, Message: msg}.Write(w)
+}
+
+func joinPaths(base, path string) string {
+	switch {
+	case base == "" || base == "/":
+		return path
+	case strings.HasSuffix(base, "/"):
+		return base + strings.TrimPrefix(path, "/")
+	case path == "/":
+		return base
+	default:
+		return base + "/" + strings.TrimPrefix(path, "/")
+	}
+}
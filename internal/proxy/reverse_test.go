@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startProxy(t *testing.T, upstream string, configure func(p *ReverseProxy)) string {
+	t.Helper()
+	p, err := NewReverseProxy(upstream)
+	require.NoError(t, err)
+	p.StripPrefix = "/api"
+	if configure != nil {
+		configure(p)
+	}
+	srv, err := server.Serve(0, p.Handle)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return fmt.Sprintf("127.0.0.1:%d", srv.Addr().(*net.TCPAddr).Port)
+}
+
+func roundTrip(t *testing.T, addr, raw string) *http.Response {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte(raw))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	return res
+}
+
+func TestReverseProxyForwardsRequest(t *testing.T) {
+	seen := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen <- r
+		bodies <- string(body)
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	defer upstream.Close()
+	addr := startProxy(t, upstream.URL+"/base", nil)
+
+	res := roundTrip(t, addr, "POST /api/items?x=1 HTTP/1.1\r\nHost: front.test\r\n"+
+		"Connection: X-Secret\r\nX-Secret: drop me\r\nX-Custom: keep\r\nProxy-Authorization: Basic abc\r\n"+
+		"Content-Length: 5\r\n\r\nhello")
+
+	r := <-seen
+	assert.Equal(t, "POST", r.Method)
+	assert.Equal(t, "/base/items", r.URL.Path)
+	assert.Equal(t, "x=1", r.URL.RawQuery)
+	assert.Equal(t, "hello", <-bodies)
+	assert.Equal(t, "keep", r.Header.Get("X-Custom"))
+	assert.Empty(t, r.Header.Get("X-Secret"))
+	assert.Empty(t, r.Header.Get("Proxy-Authorization"))
+	assert.Equal(t, "127.0.0.1", r.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "front.test", r.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", r.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "for=127.0.0.1;host=front.test;proto=http", r.Header.Get("Forwarded"))
+
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, []string{"a=1", "b=2"}, res.Header.Values("Set-Cookie"))
+	assert.Empty(t, res.Header.Get("Keep-Alive"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "created", string(body))
+}
+
+func TestReverseProxyStreamsChunkedWithTrailers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		for i := range 3 {
+			fmt.Fprintf(w, "part %d\n", i)
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set("X-Checksum", "abc")
+	}))
+	defer upstream.Close()
+	addr := startProxy(t, upstream.URL, nil)
+
+	res := roundTrip(t, addr, "GET /api/stream HTTP/1.1\r\nHost: front.test\r\n\r\n")
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "part 0\npart 1\npart 2\n", string(body))
+	assert.Equal(t, "abc", res.Trailer.Get("X-Checksum"))
+}
+
+func TestReverseProxyUpstreamFailures(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	addr := startProxy(t, "http://"+closedAddr, nil)
+	res := roundTrip(t, addr, "GET /api/ HTTP/1.1\r\nHost: front.test\r\n\r\n")
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	addr = startProxy(t, slow.URL, func(p *ReverseProxy) { p.Timeout = 50 * time.Millisecond })
+	res = roundTrip(t, addr, "GET /api/ HTTP/1.1\r\nHost: front.test\r\n\r\n")
+	assert.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+}
+
+func TestJoinPaths(t *testing.T) {
+	assert.Equal(t, "/get", joinPaths("", "/get"))
+	assert.Equal(t, "/base/get", joinPaths("/base", "/get"))
+	assert.Equal(t, "/base/get", joinPaths("/base/", "/get"))
+	assert.Equal(t, "/base", joinPaths("/base", "/"))
+	assert.True(t, strings.HasPrefix(joinPaths("/", "/x"), "/x"))
+}
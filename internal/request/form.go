@@ -0,0 +1,150 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"sync"
+)
+
+const (
+	urlEncodedType = "application/x-www-form-urlencoded"
+	multipartType  = "multipart/form-data"
+)
+
+var (
+	ErrNotMultipart    = errors.New("request Content-Type isn't multipart/form-data")
+	ErrMissingBoundary = errors.New("no multipart boundary param in Content-Type")
+)
+
+// formFiles is shared by a request and the copies WithContext makes of it,
+// so a multipart form parsed on any of them is cleaned up with the rest.
+type formFiles struct {
+	mu    sync.Mutex
+	forms []*multipart.Form
+}
+
+func (r *Request) Query() (url.Values, error) {
+	u, err := url.ParseRequestURI(r.RequestLine.RequestTarget)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request target: %s", err.Error())
+	}
+	return url.ParseQuery(u.RawQuery)
+}
+
+func (r *Request) ParseForm() error {
+	if r.Form != nil {
+		return nil
+	}
+
+	form := make(url.Values)
+	mediaType, _ := r.mediaType()
+	if mediaType == urlEncodedType {
+		bodyValues, err := url.ParseQuery(string(r.Body))
+		if err != nil {
+			return fmt.Errorf("invalid form body: %s", err.Error())
+		}
+		mergeValues(form, bodyValues)
+	}
+
+	query, err := r.Query()
+	if err != nil {
+		return err
+	}
+	mergeValues(form, query)
+
+	r.Form = form
+	return nil
+}
+
+// ParseMultipartForm reads the parts from the already buffered body, so file
+// parts are copied rather than streamed; past maxMemory they go to temporary
+// files, which RemoveTempFiles deletes.
+func (r *Request) ParseMultipartForm(maxMemory int64) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+
+	mediaType, params := r.mediaType()
+	if mediaType != multipartType {
+		return ErrNotMultipart
+	}
+	boundary, ok := params["boundary"]
+	if !ok || boundary == "" {
+		return ErrMissingBoundary
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(r.Body), boundary)
+	mf, err := mr.ReadForm(maxMemory)
+	if err != nil {
+		return fmt.Errorf("invalid multipart body: %s", err.Error())
+	}
+
+	if err := r.ParseForm(); err != nil {
+		mf.RemoveAll()
+		return err
+	}
+	form := make(url.Values)
+	mergeValues(form, mf.Value)
+	mergeValues(form, r.Form)
+
+	r.Form = form
+	r.MultipartForm = mf
+	if r.files != nil {
+		r.files.mu.Lock()
+		r.files.forms = append(r.files.forms, mf)
+		r.files.mu.Unlock()
+	}
+	return nil
+}
+
+// RemoveTempFiles deletes the files ParseMultipartForm stored on disk for this
+// request or any copy of it. The server calls it once the handler returns.
+func (r *Request) RemoveTempFiles() error {
+	if r.files == nil {
+		if r.MultipartForm == nil {
+			return nil
+		}
+		return r.MultipartForm.RemoveAll()
+	}
+	r.files.mu.Lock()
+	defer r.files.mu.Unlock()
+	var errs []error
+	for _, mf := range r.files.forms {
+		if err := mf.RemoveAll(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.files.forms = nil
+	return errors.Join(errs...)
+}
+
+func (r *Request) FormValue(key string) string {
+	if r.Form == nil {
+		if err := r.ParseForm(); err != nil {
+			return ""
+		}
+	}
+	return r.Form.Get(key)
+}
+
+func (r *Request) mediaType() (string, map[string]string) {
+	ct, ok := r.Headers.Get("Content-Type")
+	if !ok {
+		return "", nil
+	}
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return "", nil
+	}
+	return mediaType, params
+}
+
+func mergeValues(dst, src url.Values) {
+	for key, vals := range src {
+		dst[key] = append(dst[key], vals...)
+	}
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUrlEncodedFormMergedWithQuery(t *testing.T) {
+	body := "name=alvaro&lang=go&lang=zig"
+	reader := &chunkReader{
+		data: "POST /submit?lang=ocaml&page=2 HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			fmt.Sprintf("Content-Length: %d\r\n", len(body)) +
+			"\r\n" + body,
+		numBytesPerRead: 5,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "alvaro", r.FormValue("name"))
+	assert.Equal(t, []string{"go", "zig", "ocaml"}, r.Form["lang"])
+	assert.Equal(t, "2", r.Form.Get("page"))
+}
+
+func TestQueryOnlyForm(t *testing.T) {
+	reader := &chunkReader{
+		data:            "GET /search?q=http%20from%20tcp HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "http from tcp", r.FormValue("q"))
+}
+
+func TestMultipartForm(t *testing.T) {
+	fileContent := strings.Repeat("x", 100)
+	body := "--boundary42\r\n" +
+		"Content-Disposition: form-data; name=\"title\"\r\n\r\n" +
+		"my upload\r\n" +
+		"--boundary42\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"notes.txt\"\r\n" +
+		"Content-Type: text/plain\r\n\r\n" +
+		fileContent + "\r\n" +
+		"--boundary42--\r\n"
+	reader := &chunkReader{
+		data: "POST /upload?from=test HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Type: multipart/form-data; boundary=boundary42\r\n" +
+			fmt.Sprintf("Content-Length: %d\r\n", len(body)) +
+			"\r\n" + body,
+		numBytesPerRead: 7,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+
+	require.NoError(t, r.ParseMultipartForm(10))
+	defer r.MultipartForm.RemoveAll()
+	assert.Equal(t, "my upload", r.FormValue("title"))
+	assert.Equal(t, "test", r.FormValue("from"))
+
+	files := r.MultipartForm.File["file"]
+	require.Len(t, files, 1)
+	assert.Equal(t, "notes.txt", files[0].Filename)
+	assert.Equal(t, int64(len(fileContent)), files[0].Size)
+
+	f, err := files[0].Open()
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, fileContent, string(data))
+}
+
+func TestMultipartFormErrors(t *testing.T) {
+	reader := &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nContent-Type: multipart/form-data\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 8,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.ParseMultipartForm(1024), ErrMissingBoundary)
+
+	reader = &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nContent-Type: text/plain\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 8,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.ParseMultipartForm(1024), ErrNotMultipart)
+}
+
+func TestRemoveTempFilesCoversCopies(t *testing.T) {
+	body := "--b\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"big.txt\"\r\n\r\n" +
+		strings.Repeat("x", 100) + "\r\n" +
+		"--b--\r\n"
+	r, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Type: multipart/form-data; boundary=b\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n", len(body)) +
+		"\r\n" + body))
+	require.NoError(t, err)
+
+	r2 := r.WithContext(context.Background())
+	require.NoError(t, r2.ParseMultipartForm(10))
+	f, err := r2.MultipartForm.File["file"][0].Open()
+	require.NoError(t, err)
+	disk, ok := f.(*os.File)
+	require.True(t, ok, "file part should have been stored on disk")
+	path := disk.Name()
+	f.Close()
+
+	require.NoError(t, r.RemoveTempFiles())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -2,13 +2,18 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"net"
+	"net/url"
 	"strconv"
 	"strings"
 	"unicode"
 
+	"github.com/alerone/httpfromtcp/internal/cookie"
 	"github.com/alerone/httpfromtcp/internal/headers"
 )
 
@@ -24,10 +29,35 @@ const (
 type requestState int
 
 type Request struct {
-	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
-	state       requestState
+	RequestLine   RequestLine
+	Headers       headers.Headers
+	RawHeaders    []HeaderField
+	Body          []byte
+	Form          url.Values
+	MultipartForm *multipart.Form
+	RemoteAddr    string
+	ConnID        uint64
+	ctx           context.Context
+	state         requestState
+	buffered      []byte
+	files         *formFiles
+}
+
+func (r *Request) Buffered() []byte {
+	return r.buffered
+}
+
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
 }
 
 func (r *Request) parse(data []byte) (n int, err error) {
@@ -36,7 +66,7 @@ func (r *Request) parse(data []byte) (n int, err error) {
 	for r.state != rqStateDone {
 		n, err = r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
-			return 0, err
+			return totalBytesParsed, err
 		}
 
 		if n == 0 {
@@ -45,7 +75,7 @@ func (r *Request) parse(data []byte) (n int, err error) {
 
 		totalBytesParsed += n
 	}
-	return n, nil
+	return totalBytesParsed, nil
 }
 
 func (r *Request) parseSingle(data []byte) (n int, err error) {
@@ -72,6 +102,9 @@ func (r *Request) parseSingle(data []byte) (n int, err error) {
 			}
 			if done {
 				r.state = rqStateParsingBody
+			} else if n > 0 {
+				name, val, _ := strings.Cut(string(data[:n-len(crlf)]), ":")
+				r.RawHeaders = append(r.RawHeaders, HeaderField{Name: strings.TrimSpace(name), Value: strings.TrimSpace(val)})
 			}
 			return n, nil
 		}
@@ -82,17 +115,16 @@ func (r *Request) parseSingle(data []byte) (n int, err error) {
 				r.state = rqStateDone
 				return 0, nil
 			}
-			r.Body = append(r.Body, data...)
 			clNum, err := strconv.Atoi(cl)
-			if err != nil {
+			if err != nil || clNum < 0 {
 				return 0, fmt.Errorf("invalid content length not an integer: %s", cl)
 			}
-			if len(r.Body) > clNum {
-				return 0, fmt.Errorf("body length greater than content length")
-			} else if len(r.Body) == clNum {
+			n := min(clNum-len(r.Body), len(data))
+			r.Body = append(r.Body, data[:n]...)
+			if len(r.Body) == clNum {
 				r.state = rqStateDone
 			}
-			return len(data), nil
+			return n, nil
 		}
 	case rqStateDone:
 		return -1, fmt.Errorf("error: trying to parse data in done state")
@@ -101,6 +133,28 @@ func (r *Request) parseSingle(data []byte) (n int, err error) {
 	}
 }
 
+// HeaderField is a header line as it appeared on the wire, before Headers
+// folds names to lower case and joins repeated fields.
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// ParseError reports where in the stream a request stopped parsing. Offset
+// is the position of the request line, header line or body that was rejected.
+type ParseError struct {
+	Offset int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("error while parsing request at byte %d: %s", e.Offset, e.Err.Error())
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 type RequestLine struct {
 	Method        string
 	RequestTarget string
@@ -112,8 +166,10 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 		state:   rqStateInitialized,
 		Headers: headers.NewHeaders(),
 		Body: []byte(""),
+		files:   &formFiles{},
 	}
 	readToIndex := 0
+	consumed := 0
 	buf := make([]byte, bufferSize, bufferSize)
 	for request.state != rqStateDone {
 		if readToIndex >= len(buf) {
@@ -134,12 +190,16 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 
 		pn, err := request.parse(buf[:readToIndex])
 		if err != nil {
-			return nil, fmt.Errorf("error while parsing request: %s", err.Error())
+			return nil, &ParseError{Offset: consumed + pn, Err: err}
 		}
+		consumed += pn
 
 		copy(buf, buf[pn:])
 		readToIndex -= pn
 	}
+	if readToIndex > 0 {
+		request.buffered = bytes.Clone(buf[:readToIndex])
+	}
 	return request, nil
 }
 
@@ -184,6 +244,12 @@ func requestLineFromString(line string) (*RequestLine, error) {
 		return nil, fmt.Errorf("unrecognized HTTP-version %s", version)
 	}
 
+	if method == "CONNECT" {
+		if _, _, err := SplitAuthority(parts[1]); err != nil {
+			return nil, err
+		}
+	}
+
 	return &RequestLine{
 		Method:        method,
 		RequestTarget: parts[1],
@@ -191,6 +257,18 @@ func requestLineFromString(line string) (*RequestLine, error) {
 	}, nil
 }
 
+func SplitAuthority(target string) (host string, port int, err error) {
+	host, portText, err := net.SplitHostPort(target)
+	if err != nil || host == "" {
+		return "", 0, fmt.Errorf("invalid authority-form target: %s", target)
+	}
+	port, err = strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in authority-form target: %s", target)
+	}
+	return host, port, nil
+}
+
 func checkMethodIsUpper(method string) bool {
 	for _, r := range method {
 		if !unicode.IsUpper(r) && unicode.IsLetter(r) {
@@ -199,3 +277,20 @@ func checkMethodIsUpper(method string) bool {
 	}
 	return true
 }
+
+func (r *Request) Cookies() []*cookie.Cookie {
+	header, ok := r.Headers.Get("Cookie")
+	if !ok {
+		return nil
+	}
+	return cookie.Parse(header)
+}
+
+func (r *Request) Cookie(name string) (*cookie.Cookie, bool) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
@@ -2,8 +2,10 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
+	"github.com/alerone/httpfromtcp/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -232,3 +234,110 @@ func BodyShorterThanReportedContentLength(t *testing.T) {
 	_, err := RequestFromReader(reader)
 	require.Error(t, err)
 }
+
+func TestRequestCookies(t *testing.T) {
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nCookie: session=abc; theme=dark\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.Len(t, r.Cookies(), 2)
+
+	c, ok := r.Cookie("theme")
+	require.True(t, ok)
+	assert.Equal(t, "dark", c.Value)
+
+	_, ok = r.Cookie("missing")
+	assert.False(t, ok)
+}
+
+func TestRequestStopsAtContentLength(t *testing.T) {
+	reader := &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhelloEXTRA BYTES",
+		numBytesPerRead: 64,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: -1\r\n\r\nhello",
+		numBytesPerRead: 64,
+	}
+	_, err = RequestFromReader(reader)
+	assert.Error(t, err)
+}
+
+func TestParseReportsEveryByteConsumed(t *testing.T) {
+	head := "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\n"
+	r := &Request{state: rqStateInitialized, Headers: headers.NewHeaders()}
+	n, err := r.parse([]byte(head + "helloEXTRA"))
+	require.NoError(t, err)
+	assert.Equal(t, len(head)+5, n)
+	assert.Equal(t, "hello", string(r.Body))
+}
+
+func TestRequestKeepsBufferedBytes(t *testing.T) {
+	reader := &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhelloEXTRA BYTES",
+		numBytesPerRead: 64,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.NotEmpty(t, r.Buffered())
+	assert.Equal(t, "EXTRA BYTES", string(r.Buffered())+string(rest))
+}
+
+func TestConnectRequestLine(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n"))
+	require.NoError(t, err)
+	host, port, err := SplitAuthority(r.RequestLine.RequestTarget)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", host)
+	assert.Equal(t, 443, port)
+
+	_, err = RequestFromReader(strings.NewReader("CONNECT /path HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	assert.Error(t, err)
+	_, err = RequestFromReader(strings.NewReader("CONNECT example.com:99999 HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	assert.Error(t, err)
+}
+
+func TestParseErrorOffset(t *testing.T) {
+	for _, perRead := range []int{1, 3, 64} {
+		reader := &chunkReader{
+			data:            "GET / HTTP/1.1\r\nHost: localhost\r\nBad Header: x\r\n\r\n",
+			numBytesPerRead: perRead,
+		}
+		_, err := RequestFromReader(reader)
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, len("GET / HTTP/1.1\r\nHost: localhost\r\n"), perr.Offset)
+	}
+
+	_, err := RequestFromReader(strings.NewReader("get / HTTP/1.1\r\n\r\n"))
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 0, perr.Offset)
+	assert.Contains(t, err.Error(), "at byte 0")
+}
+
+func TestRawHeadersKeepOrder(t *testing.T) {
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost\r\nX-B: 1\r\nAccept: */*\r\nx-b: 2\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, []HeaderField{
+		{Name: "Host", Value: "localhost"},
+		{Name: "X-B", Value: "1"},
+		{Name: "Accept", Value: "*/*"},
+		{Name: "x-b", Value: "2"},
+	}, r.RawHeaders)
+	xb, _ := r.Headers.Get("X-B")
+	assert.Equal(t, "1, 2", xb)
+}
@@ -0,0 +1,150 @@
+package response
+
+import (
+	"strings"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+)
+
+type condResult int
+
+const (
+	condNone condResult = iota
+	condTrue
+	condFalse
+)
+
+func StrongETag(tag string) string {
+	return `"` + tag + `"`
+}
+
+func WeakETag(tag string) string {
+	return `W/"` + tag + `"`
+}
+
+func CheckPreconditions(w *Writer, r *request.Request, etag string, modtime time.Time) bool {
+	method := r.RequestLine.Method
+	isGetOrHead := method == "GET" || method == "HEAD"
+
+	ch := checkIfMatch(r.Headers, etag)
+	if ch == condNone {
+		ch = checkIfUnmodifiedSince(r.Headers, modtime)
+	}
+	if ch == condFalse {
+		writePreconditionFailed(w)
+		return true
+	}
+
+	switch checkIfNoneMatch(r.Headers, etag) {
+	case condFalse:
+		if isGetOrHead {
+			writeNotModified(w, etag, modtime)
+		} else {
+			writePreconditionFailed(w)
+		}
+		return true
+	case condNone:
+		if isGetOrHead && checkIfModifiedSince(r.Headers, modtime) == condFalse {
+			writeNotModified(w, etag, modtime)
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkIfMatch(h headers.Headers, etag string) condResult {
+	im, ok := h.Get("If-Match")
+	if !ok {
+		return condNone
+	}
+	for _, tag := range splitETags(im) {
+		if tag == "*" || strongMatch(tag, etag) {
+			return condTrue
+		}
+	}
+	return condFalse
+}
+
+func checkIfUnmodifiedSince(h headers.Headers, modtime time.Time) condResult {
+	ius, ok := h.Get("If-Unmodified-Since")
+	if !ok || modtime.IsZero() {
+		return condNone
+	}
+	t, err := headers.ParseTime(ius)
+	if err != nil {
+		return condNone
+	}
+	if modtime.Truncate(time.Second).After(t) {
+		return condFalse
+	}
+	return condTrue
+}
+
+func checkIfNoneMatch(h headers.Headers, etag string) condResult {
+	inm, ok := h.Get("If-None-Match")
+	if !ok {
+		return condNone
+	}
+	for _, tag := range splitETags(inm) {
+		if tag == "*" || weakMatch(tag, etag) {
+			return condFalse
+		}
+	}
+	return condTrue
+}
+
+func checkIfModifiedSince(h headers.Headers, modtime time.Time) condResult {
+	ims, ok := h.Get("If-Modified-Since")
+	if !ok || modtime.IsZero() {
+		return condNone
+	}
+	t, err := headers.ParseTime(ims)
+	if err != nil {
+		return condNone
+	}
+	if modtime.Truncate(time.Second).After(t) {
+		return condTrue
+	}
+	return condFalse
+}
+
+func splitETags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func strongMatch(a, b string) bool {
+	return a != "" && a == b && !strings.HasPrefix(a, "W/")
+}
+
+func weakMatch(a, b string) bool {
+	return a != "" && b != "" && strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+func writeNotModified(w *Writer, etag string, modtime time.Time) {
+	hdrs := headers.NewHeaders()
+	if etag != "" {
+		hdrs.Set("ETag", etag)
+	}
+	if !modtime.IsZero() {
+		hdrs.Set("Last-Modified", headers.FormatTime(modtime))
+	}
+	w.WriteStatusLine(NotModifiedStatus)
+	w.WriteHeaders(hdrs)
+	w.WriteEmptyBody()
+}
+
+func writePreconditionFailed(w *Writer) {
+	msg := "precondition failed"
+	w.WriteStatusLine(PreconditionFailedStatus)
+	w.WriteHeaders(GetDefaultHeaders(len(msg)))
+	w.WriteBody([]byte(msg))
+}
@@ -0,0 +1,72 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var condModTime = time.Date(2025, time.May, 1, 10, 0, 0, 0, time.UTC)
+
+func checkConditional(t *testing.T, method, reqHeaders, etag string) (bool, string) {
+	t.Helper()
+	rq, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost:42069\r\n" + reqHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	w := NewWriter(out)
+	done := CheckPreconditions(&w, rq, etag, condModTime)
+	return done, out.String()
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	done, res := checkConditional(t, "GET", "If-None-Match: \"a\", W/\"v1\"\r\n", StrongETag("v1"))
+	require.True(t, done)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, res, "Etag: \"v1\"\r\n")
+	assert.NotContains(t, res, "Content-Length")
+	assert.NotContains(t, res, "Connection")
+
+	done, res = checkConditional(t, "POST", "If-None-Match: *\r\n", StrongETag("v1"))
+	require.True(t, done)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 412 Precondition Failed\r\n"))
+
+	done, _ = checkConditional(t, "GET", "If-None-Match: \"v2\"\r\n", StrongETag("v1"))
+	assert.False(t, done)
+}
+
+func TestIfMatch(t *testing.T) {
+	done, _ := checkConditional(t, "PUT", "If-Match: \"v1\"\r\n", StrongETag("v1"))
+	assert.False(t, done)
+
+	done, res := checkConditional(t, "PUT", "If-Match: \"v1\"\r\n", WeakETag("v1"))
+	require.True(t, done)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 412 Precondition Failed\r\n"))
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	done, res := checkConditional(t, "GET", "If-Modified-Since: "+headers.FormatTime(condModTime)+"\r\n", "")
+	require.True(t, done)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 304 Not Modified\r\n"))
+
+	done, _ = checkConditional(t, "GET", "If-Modified-Since: "+headers.FormatTime(condModTime.Add(-time.Hour))+"\r\n", "")
+	assert.False(t, done)
+
+	done, _ = checkConditional(t, "GET", "If-None-Match: \"v2\"\r\nIf-Modified-Since: "+headers.FormatTime(condModTime)+"\r\n", StrongETag("v1"))
+	assert.False(t, done)
+}
+
+func TestIfUnmodifiedSince(t *testing.T) {
+	done, res := checkConditional(t, "DELETE", "If-Unmodified-Since: "+headers.FormatTime(condModTime.Add(-time.Hour))+"\r\n", "")
+	require.True(t, done)
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 412 Precondition Failed\r\n"))
+
+	done, _ = checkConditional(t, "DELETE", "If-Match: *\r\nIf-Unmodified-Since: "+headers.FormatTime(condModTime.Add(-time.Hour))+"\r\n", "")
+	assert.False(t, done)
+}
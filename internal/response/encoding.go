@@ -0,0 +1,86 @@
+package response
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+)
+
+type BodyEncoder func(out io.Writer) io.WriteCloser
+
+type EncodingSelector func(statusCode StatusCode, hdrs headers.Headers) BodyEncoder
+
+type flusher interface {
+	Flush() error
+}
+
+type chunkWriter struct {
+	out io.Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := cw.out.Write(fmt.Appendf(nil, "%X\r\n", len(p))); err != nil {
+		return 0, err
+	}
+	if _, err := cw.out.Write(p); err != nil {
+		return 0, err
+	}
+	if _, err := cw.out.Write([]byte("\r\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *Writer) Flush() error {
+	if f, ok := w.out.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (w *Writer) UseEncoding(selector EncodingSelector) {
+	w.selectEncoding = selector
+}
+
+func (w *Writer) writeEncoded(src io.Reader) (int, error) {
+	enc := w.encoder(chunkWriter{out: w.out})
+	n, err := io.Copy(enc, src)
+	if err != nil {
+		return int(n), err
+	}
+	if err := enc.Close(); err != nil {
+		return int(n), err
+	}
+	w.out.Write([]byte("0\r\n\r\n"))
+	return int(n), nil
+}
+
+func (w *Writer) writeEncodedChunk(p []byte) (int, error) {
+	if w.encodedBody == nil {
+		w.encodedBody = w.encoder(chunkWriter{out: w.out})
+	}
+	n, err := w.encodedBody.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if f, ok := w.encodedBody.(flusher); ok {
+		return n, f.Flush()
+	}
+	return n, nil
+}
+
+func (w *Writer) closeEncodedBody() error {
+	if w.encoder == nil {
+		return nil
+	}
+	if w.encodedBody == nil {
+		w.encodedBody = w.encoder(chunkWriter{out: w.out})
+	}
+	err := w.encodedBody.Close()
+	w.encodedBody = nil
+	return err
+}
@@ -0,0 +1,39 @@
+package response
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	ErrHijacked      = errors.New("response: connection has been hijacked")
+	ErrNotHijackable = errors.New("response: writer does not support hijacking")
+)
+
+type Hijacker func() (net.Conn, []byte, error)
+
+func (w *Writer) SetHijacker(h Hijacker) {
+	w.hijacker = h
+}
+
+func (w *Writer) Hijack() (net.Conn, []byte, error) {
+	if w.state == hijackedState {
+		return nil, nil, ErrHijacked
+	}
+	if w.hijacker == nil {
+		return nil, nil, ErrNotHijackable
+	}
+	if err := w.Flush(); err != nil {
+		return nil, nil, err
+	}
+	conn, buffered, err := w.hijacker()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.state = hijackedState
+	return conn, buffered, nil
+}
+
+func (w *Writer) Hijacked() bool {
+	return w.state == hijackedState
+}
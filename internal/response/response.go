@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
+	"github.com/alerone/httpfromtcp/internal/cookie"
 	"github.com/alerone/httpfromtcp/internal/headers"
 )
 
@@ -13,9 +15,25 @@ type StatusCode int
 type writerState int
 
 const (
-	OkStatus                  StatusCode = 200
-	BadRequestStatus          StatusCode = 400
-	InternalServerErrorStatus StatusCode = 500
+	SwitchingProtocolsStatus   StatusCode = 101
+	OkStatus                   StatusCode = 200
+	PartialContentStatus       StatusCode = 206
+	MovedPermanentlyStatus     StatusCode = 301
+	NotModifiedStatus          StatusCode = 304
+	BadRequestStatus           StatusCode = 400
+	ForbiddenStatus            StatusCode = 403
+	NotFoundStatus             StatusCode = 404
+	MethodNotAllowedStatus     StatusCode = 405
+	NotAcceptableStatus        StatusCode = 406
+	PreconditionFailedStatus   StatusCode = 412
+	ContentTooLargeStatus      StatusCode = 413
+	UnsupportedMediaTypeStatus StatusCode = 415
+	RangeNotSatisfiableStatus  StatusCode = 416
+	UpgradeRequiredStatus      StatusCode = 426
+	InternalServerErrorStatus  StatusCode = 500
+	BadGatewayStatus           StatusCode = 502
+	ServiceUnavailableStatus   StatusCode = 503
+	GatewayTimeoutStatus       StatusCode = 504
 )
 
 const (
@@ -31,20 +49,43 @@ const (
 	writingBody
 	writingChunkedBody
 	writingTrailers
+	hijackedState
 )
 
 var codeReasons = map[StatusCode]string{
-	OkStatus:                  "OK",
-	BadRequestStatus:          "Bad Request",
-	InternalServerErrorStatus: "Internal Server Error",
+	SwitchingProtocolsStatus:   "Switching Protocols",
+	OkStatus:                   "OK",
+	PartialContentStatus:       "Partial Content",
+	MovedPermanentlyStatus:     "Moved Permanently",
+	NotModifiedStatus:          "Not Modified",
+	BadRequestStatus:           "Bad Request",
+	ForbiddenStatus:            "Forbidden",
+	NotFoundStatus:             "Not Found",
+	MethodNotAllowedStatus:     "Method Not Allowed",
+	NotAcceptableStatus:        "Not Acceptable",
+	PreconditionFailedStatus:   "Precondition Failed",
+	ContentTooLargeStatus:      "Content Too Large",
+	UnsupportedMediaTypeStatus: "Unsupported Media Type",
+	RangeNotSatisfiableStatus:  "Range Not Satisfiable",
+	UpgradeRequiredStatus:      "Upgrade Required",
+	InternalServerErrorStatus:  "Internal Server Error",
+	BadGatewayStatus:           "Bad Gateway",
+	ServiceUnavailableStatus:   "Service Unavailable",
+	GatewayTimeoutStatus:       "Gateway Timeout",
 }
 
 type Writer struct {
-	statusCode StatusCode
-	Headers    headers.Headers
-	body       []byte
-	out        io.Writer
-	state      writerState
+	statusCode     StatusCode
+	Headers        headers.Headers
+	body           []byte
+	out            io.Writer
+	state          writerState
+	selectEncoding EncodingSelector
+	encoder        BodyEncoder
+	encodedBody    io.WriteCloser
+	cookies        []string
+	headerHooks    []func(StatusCode, headers.Headers)
+	hijacker       Hijacker
 }
 
 func NewWriter(out io.Writer) Writer {
@@ -74,12 +115,83 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 			actual:        w.state,
 		}
 	}
+	for _, hook := range w.headerHooks {
+		hook(w.statusCode, headers)
+	}
 	w.state = writingHdrs
 	w.Headers = headers
+	if w.selectEncoding != nil {
+		w.encoder = w.selectEncoding(w.statusCode, headers)
+		if w.encoder != nil {
+			headers.Remove("Content-Length")
+			headers.Set("Transfer-Encoding", "chunked")
+		}
+	}
 	for key, val := range headers {
 		w.out.Write(fmt.Appendf(nil, "%s: %s\r\n", key, val))
 	}
+	for _, c := range w.cookies {
+		w.out.Write(fmt.Appendf(nil, "Set-Cookie: %s\r\n", c))
+	}
+
+	return nil
+}
+
+func (w *Writer) OnWriteHeaders(hook func(StatusCode, headers.Headers)) {
+	w.headerHooks = append(w.headerHooks, hook)
+}
 
+// Tee copies everything written from now on to dst as well as to the
+// connection. Flush still reaches the connection.
+func (w *Writer) Tee(dst io.Writer) {
+	w.out = &teeWriter{out: w.out, copy: dst}
+}
+
+type teeWriter struct {
+	out  io.Writer
+	copy io.Writer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.out.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return t.copy.Write(p)
+}
+
+func (t *teeWriter) Flush() error {
+	if f, ok := t.out.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (w *Writer) SetCookie(c *cookie.Cookie) error {
+	if w.state != initState && w.state != writingStatus {
+		return &InvalidOrderResponseWriter{
+			expectedState: writingStatus,
+			actual:        w.state,
+		}
+	}
+	if err := c.Valid(); err != nil {
+		return err
+	}
+	w.cookies = append(w.cookies, c.String())
+	return nil
+}
+
+func (w *Writer) AddSetCookieLine(line string) error {
+	if w.state != initState && w.state != writingStatus {
+		return &InvalidOrderResponseWriter{
+			expectedState: writingStatus,
+			actual:        w.state,
+		}
+	}
+	if strings.ContainsAny(line, "\r\n\x00") {
+		return fmt.Errorf("invalid Set-Cookie line: %q", line)
+	}
+	w.cookies = append(w.cookies, line)
 	return nil
 }
 
@@ -90,6 +202,12 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 			actual:        w.state,
 		}
 	}
+	if w.encoder != nil {
+		w.out.Write([]byte("\r\n"))
+		w.state = writingBody
+		w.body = p
+		return w.writeEncoded(bytes.NewReader(p))
+	}
 	bodyCount := len(p)
 	if _, ok := w.Headers.Get("Content-Length"); !ok {
 		w.Headers.Set("Content-Length", strconv.Itoa(bodyCount))
@@ -102,6 +220,34 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	return len(p) + 2, nil
 }
 
+func (w *Writer) WriteBodyFrom(src io.Reader) (int64, error) {
+	if w.state != writingHdrs {
+		return 0, &InvalidOrderResponseWriter{
+			expectedState: writingHdrs,
+			actual:        w.state,
+		}
+	}
+	w.out.Write([]byte("\r\n"))
+	w.state = writingBody
+	if w.encoder != nil {
+		n, err := w.writeEncoded(src)
+		return int64(n), err
+	}
+	return io.Copy(w.out, src)
+}
+
+func (w *Writer) WriteEmptyBody() error {
+	if w.state != writingHdrs {
+		return &InvalidOrderResponseWriter{
+			expectedState: writingHdrs,
+			actual:        w.state,
+		}
+	}
+	w.out.Write([]byte("\r\n"))
+	w.state = writingBody
+	return nil
+}
+
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.state != writingChunkedBody {
 		if w.state != writingHdrs {
@@ -114,18 +260,25 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	}
 	w.state = writingChunkedBody
 
+	if w.encoder != nil {
+		return w.writeEncodedChunk(p)
+	}
 	encoding := fmt.Appendf(nil, "%X\r\n%s\r\n", len(p), string(p))
 	w.out.Write(encoding)
 	return len(encoding), nil
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	if w.state != writingBody {
+	if w.state != writingChunkedBody {
 		return 0, &InvalidOrderResponseWriter{
-			expectedState: writingBody,
+			expectedState: writingChunkedBody,
 			actual:        w.state,
 		}
 	}
+	w.state = writingTrailers
+	if err := w.closeEncodedBody(); err != nil {
+		return 0, err
+	}
 	encoding := fmt.Appendf(nil, "%X\r\n\r\n", 0)
 	w.out.Write(encoding)
 
@@ -140,6 +293,9 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 		}
 	}
 	w.state = writingTrailers
+	if err := w.closeEncodedBody(); err != nil {
+		return err
+	}
 	w.out.Write(fmt.Append(nil, "0\r\n"))
 	for key, val := range h {
 		w.out.Write(fmt.Appendf(nil, "%s: %s\r\n", key, val))
@@ -163,6 +319,10 @@ func writeStatusLine(w io.Writer, statusCode StatusCode) {
 	return
 }
 
+func ReasonPhrase(statusCode StatusCode) string {
+	return codeReasons[statusCode]
+}
+
 func GetDefaultHeaders(contentLen int) headers.Headers {
 	defaults := headers.NewHeaders()
 
@@ -189,6 +349,8 @@ func (ws *writerState) String() string {
 		out.WriteString("just wrote chunked body")
 	case writingTrailers:
 		out.WriteString("just wrote trailers")
+	case hijackedState:
+		out.WriteString("connection hijacked")
 	default:
 		out.WriteString("error order unknown")
 	}
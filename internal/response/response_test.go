@@ -0,0 +1,43 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alerone/httpfromtcp/internal/cookie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCookieWritesSeparateFields(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := NewWriter(out)
+	require.NoError(t, w.WriteStatusLine(OkStatus))
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "a", Value: "1", HttpOnly: true}))
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "b", Value: "2", Path: "/"}))
+	require.Error(t, w.SetCookie(&cookie.Cookie{Name: "bad name", Value: "3"}))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	w.WriteBody(nil)
+
+	res := out.String()
+	assert.Contains(t, res, "\r\nSet-Cookie: a=1; HttpOnly\r\n")
+	assert.Contains(t, res, "\r\nSet-Cookie: b=2; Path=/\r\n")
+	assert.Equal(t, 2, strings.Count(res, "Set-Cookie"))
+
+	assert.Error(t, w.SetCookie(&cookie.Cookie{Name: "late", Value: "x"}))
+}
+
+func TestTeeCopiesWrittenBytes(t *testing.T) {
+	out := new(bytes.Buffer)
+	copied := new(bytes.Buffer)
+	w := NewWriter(out)
+	require.NoError(t, w.WriteStatusLine(OkStatus))
+	w.Tee(copied)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	w.WriteBody([]byte("hi"))
+
+	assert.True(t, strings.HasPrefix(out.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Equal(t, strings.TrimPrefix(out.String(), "HTTP/1.1 200 OK\r\n"), copied.String())
+	assert.True(t, strings.HasSuffix(copied.String(), "\r\n\r\nhi"))
+}
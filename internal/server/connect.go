@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+)
+
+const (
+	defaultDialTimeout = 10 * time.Second
+	defaultIdleTimeout = 2 * time.Minute
+)
+
+type ConnectProxy struct {
+	// Allow holds host:port patterns. The host may be "*" or start with
+	// "*." to match subdomains and the port may be "*". An empty list
+	// rejects every tunnel.
+	Allow       []string
+	DialTimeout time.Duration
+	IdleTimeout time.Duration
+}
+
+func WithConnectProxy(proxy ConnectProxy) Option {
+	return func(s *Server) {
+		s.connectProxy = &proxy
+	}
+}
+
+func (p *ConnectProxy) Allowed(host string, port int) bool {
+	for _, pattern := range p.Allow {
+		patternHost, patternPort, err := net.SplitHostPort(pattern)
+		if err != nil {
+			continue
+		}
+		if patternPort != "*" && patternPort != strconv.Itoa(port) {
+			continue
+		}
+		if matchHost(patternHost, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHost(pattern, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	pattern = strings.ToLower(pattern)
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	default:
+		return host == pattern
+	}
+}
+
+func (s *Server) tunnel(conn net.Conn, rq *request.Request) {
+	proxy := s.connectProxy
+	buf := bufio.NewWriter(conn)
+	writer := response.NewWriter(buf)
+	defer buf.Flush()
+
+	host, port, err := request.SplitAuthority(rq.RequestLine.RequestTarget)
+	if err != nil {
+		HandlerError{StatusCode: response.BadRequestStatus, Message: err.Error()}.Write(&writer)
+		return
+	}
+	if !proxy.Allowed(host, port) {
+		HandlerError{StatusCode: response.ForbiddenStatus, Message: "tunnel target not allowed\n"}.Write(&writer)
+		return
+	}
+
+	dialTimeout := proxy.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	upstream, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), dialTimeout)
+	if err != nil {
+		status := response.BadGatewayStatus
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			status = response.GatewayTimeoutStatus
+		}
+		HandlerError{StatusCode: status, Message: fmt.Sprintf("dialing %s failed\n", rq.RequestLine.RequestTarget)}.Write(&writer)
+		return
+	}
+	defer upstream.Close()
+
+	writer.WriteStatusLine(response.OkStatus)
+	writer.WriteHeaders(headers.NewHeaders())
+	writer.WriteEmptyBody()
+	if err := buf.Flush(); err != nil {
+		return
+	}
+	if early := rq.Buffered(); len(early) > 0 {
+		if _, err := upstream.Write(early); err != nil {
+			return
+		}
+	}
+
+	idleTimeout := proxy.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	pipe(conn, upstream, idleTimeout)
+}
+
+// pipe copies in both directions until both sides are done or neither side
+// has sent anything for idleTimeout.
+func pipe(client, upstream net.Conn, idleTimeout time.Duration) {
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		err := idleCopy(dst, src, idleTimeout, &lastActivity)
+		if err != nil {
+			client.Close()
+			upstream.Close()
+			return
+		}
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}
+	go copyHalf(upstream, client)
+	go copyHalf(client, upstream)
+	wg.Wait()
+}
+
+func idleCopy(dst, src net.Conn, idleTimeout time.Duration, lastActivity *atomic.Int64) error {
+	buf := make([]byte, 32*1024)
+	for {
+		src.SetReadDeadline(time.Now().Add(idleTimeout))
+		n, err := src.Read(buf)
+		if n > 0 {
+			lastActivity.Store(time.Now().UnixNano())
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			idle := time.Since(time.Unix(0, lastActivity.Load()))
+			if idle < idleTimeout {
+				continue
+			}
+		}
+		return err
+	}
+}
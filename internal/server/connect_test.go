@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startEchoUpstream(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func startProxy(t *testing.T, proxy ConnectProxy) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		HandlerError{StatusCode: response.NotFoundStatus, Message: "not found"}.Write(w)
+	}, WithConnectProxy(proxy))
+	return conn, bufio.NewReader(conn)
+}
+
+func readHead(t *testing.T, br *bufio.Reader) string {
+	t.Helper()
+	status, err := br.ReadString('\n')
+	require.NoError(t, err)
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			return status
+		}
+	}
+}
+
+func TestConnectTunnel(t *testing.T) {
+	upstream := startEchoUpstream(t)
+	conn, br := startProxy(t, ConnectProxy{Allow: []string{"127.0.0.1:*"}})
+
+	_, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\nearly ", upstream, upstream)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", readHead(t, br))
+
+	_, err = conn.Write([]byte("bytes\n"))
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "early bytes\n", line)
+}
+
+func TestConnectRejectsDisallowedTarget(t *testing.T) {
+	upstream := startEchoUpstream(t)
+	conn, br := startProxy(t, ConnectProxy{Allow: []string{"example.com:443"}})
+
+	_, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", upstream, upstream)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 403 Forbidden\r\n", readHead(t, br))
+}
+
+func TestConnectBadGateway(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	conn, br := startProxy(t, ConnectProxy{Allow: []string{"127.0.0.1:*"}})
+	_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", closedAddr, closedAddr)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 502 Bad Gateway\r\n", readHead(t, br))
+}
+
+func TestConnectIdleTimeout(t *testing.T) {
+	upstream := startEchoUpstream(t)
+	conn, br := startProxy(t, ConnectProxy{Allow: []string{"127.0.0.1:*"}, IdleTimeout: 100 * time.Millisecond})
+
+	_, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", upstream, upstream)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", readHead(t, br))
+
+	start := time.Now()
+	_, err = br.ReadByte()
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestConnectAllowList(t *testing.T) {
+	proxy := ConnectProxy{Allow: []string{"*.example.com:443", "localhost:*"}}
+	assert.True(t, proxy.Allowed("api.example.com", 443))
+	assert.False(t, proxy.Allowed("example.com", 443))
+	assert.False(t, proxy.Allowed("api.example.com", 80))
+	assert.True(t, proxy.Allowed("LOCALHOST", 8080))
+	assert.False(t, (&ConnectProxy{}).Allowed("localhost", 80))
+}
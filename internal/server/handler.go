@@ -12,5 +12,9 @@ type HandlerError struct {
 	Message    string
 }
 
-
-
+func (he HandlerError) Write(w *response.Writer) {
+	w.WriteStatusLine(he.StatusCode)
+	hdrs := response.GetDefaultHeaders(len(he.Message))
+	w.WriteHeaders(hdrs)
+	w.WriteBody([]byte(he.Message))
+}
@@ -1,23 +1,30 @@
 package server
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"sync/atomic"
+	"time"
 
 	"github.com/alerone/httpfromtcp/internal/request"
 	"github.com/alerone/httpfromtcp/internal/response"
 )
 
 type Server struct {
-	closed   atomic.Bool
-	listener net.Listener
-	handler  Handler
+	closed       atomic.Bool
+	listener     net.Listener
+	handler      Handler
+	connectProxy *ConnectProxy
+	lastConnID   atomic.Uint64
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
+type Option func(*Server)
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, fmt.Errorf("starting http server error: %s", err.Error())
@@ -27,6 +34,9 @@ func Serve(port int, handler Handler) (*Server, error) {
 		handler:  handler,
 		listener: listener,
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
 
 	go server.listen()
 
@@ -57,8 +67,18 @@ func (s *Server) listen() {
 	}
 }
 
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
 func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
+	hijacked := false
+	defer func() {
+		if !hijacked {
+			conn.Close()
+		}
+	}()
+
 	rq, err := request.RequestFromReader(conn)
 	if err != nil {
 		fmt.Println(err.Error())
@@ -66,9 +86,110 @@ func (s *Server) handle(conn net.Conn) {
 		conn.Write([]byte(errorMsg))
 		return
 	}
+	rq.RemoteAddr = conn.RemoteAddr().String()
+	rq.ConnID = s.lastConnID.Add(1)
+
+	if rq.RequestLine.Method == "CONNECT" && s.connectProxy != nil {
+		s.tunnel(conn, rq)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer rq.RemoveTempFiles()
+	watcher := watchDisconnect(conn, cancel)
 
-	buf := new(bytes.Buffer)
+	buf := bufio.NewWriter(watcher)
 	writer := response.NewWriter(buf)
-	s.handler(&writer, rq)
-	buf.WriteTo(conn)
+	writer.SetHijacker(func() (net.Conn, []byte, error) {
+		if err := buf.Flush(); err != nil {
+			return nil, nil, err
+		}
+		extra, err := watcher.stop()
+		if err != nil {
+			return nil, nil, err
+		}
+		hijacked = true
+		return conn, append(rq.Buffered(), extra...), nil
+	})
+	s.handler(&writer, rq.WithContext(ctx))
+	if hijacked {
+		return
+	}
+	buf.Flush()
+}
+
+// maxWatchedBytes caps how much a client may send after its request while
+// the handler runs.
+const maxWatchedBytes = 64 << 10
+
+var ErrTooMuchBuffered = errors.New("server: client sent too much data before the connection was hijacked")
+
+type disconnectWatcher struct {
+	conn     net.Conn
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopping atomic.Bool
+	read     []byte
+	overflow bool
+}
+
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) *disconnectWatcher {
+	dw := &disconnectWatcher{
+		conn:   conn,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go dw.run()
+	return dw
+}
+
+// run cancels the request context when the client stops sending. The whole
+// request has been read by the time run starts, so an EOF, even from a
+// half-close, means the client is done; responses to a half-closed
+// connection still go out. Bytes read meanwhile are kept for a hijacker, up
+// to maxWatchedBytes, past which the client is treated as misbehaving.
+func (dw *disconnectWatcher) run() {
+	defer close(dw.done)
+	buf := make([]byte, 512)
+	for {
+		n, err := dw.conn.Read(buf)
+		if len(dw.read)+n > maxWatchedBytes {
+			dw.overflow = true
+			dw.cancel()
+			return
+		}
+		dw.read = append(dw.read, buf[:n]...)
+		if err != nil {
+			if !dw.stopping.Load() {
+				dw.cancel()
+			}
+			return
+		}
+	}
+}
+
+func (dw *disconnectWatcher) Write(p []byte) (int, error) {
+	n, err := dw.conn.Write(p)
+	if err != nil {
+		dw.cancel()
+	}
+	return n, err
+}
+
+// stop unblocks the pending read and hands back whatever the watcher
+// consumed from the connection so it is not lost to the next reader.
+func (dw *disconnectWatcher) stop() ([]byte, error) {
+	dw.stopping.Store(true)
+	if err := dw.conn.SetReadDeadline(time.Unix(1, 0)); err != nil {
+		return nil, err
+	}
+	<-dw.done
+	if dw.overflow {
+		return nil, ErrTooMuchBuffered
+	}
+	if err := dw.conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return dw.read, nil
 }
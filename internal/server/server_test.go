@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/sse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler Handler, opts ...Option) net.Conn {
+	t.Helper()
+	srv, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", srv.Addr().(*net.TCPAddr).Port))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestHijackReturnsBufferedBytes(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.SwitchingProtocolsStatus)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		w.WriteEmptyBody()
+
+		raw, buffered, err := w.Hijack()
+		if err != nil {
+			return
+		}
+		defer raw.Close()
+		rd := io.MultiReader(bytes.NewReader(buffered), raw)
+		line, err := bufio.NewReader(rd).ReadString('\n')
+		if err != nil {
+			return
+		}
+		raw.Write([]byte("echo: " + line))
+	})
+
+	_, err := conn.Write([]byte("GET /tunnel HTTP/1.1\r\nHost: localhost\r\n\r\nearly "))
+	require.NoError(t, err)
+
+	br := bufio.NewReader(conn)
+	status, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", status)
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	_, err = conn.Write([]byte("late\n"))
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "echo: early late\n", line)
+}
+
+func TestHijackTwice(t *testing.T) {
+	errs := make(chan error, 1)
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		raw, _, err := w.Hijack()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer raw.Close()
+		_, _, err = w.Hijack()
+		errs <- err
+		assert.Error(t, w.WriteStatusLine(response.OkStatus))
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, <-errs, response.ErrHijacked)
+}
+
+func TestHalfCloseStillGetsResponse(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		body := []byte("cancelled")
+		select {
+		case <-req.Context().Done():
+		case <-time.After(time.Second):
+			body = []byte("still running")
+		}
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(res, []byte("HTTP/1.1 200 OK\r\n")))
+	assert.True(t, bytes.HasSuffix(res, []byte("cancelled")))
+}
+
+func TestCloseEndsEventStream(t *testing.T) {
+	done := make(chan struct{})
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		stream, err := sse.NewStream(w, req)
+		if err != nil {
+			return
+		}
+		select {
+		case <-stream.Done():
+			close(done)
+		case <-time.After(2 * time.Second):
+		}
+	})
+
+	_, err := conn.Write([]byte("GET /events HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	// Read up to the opening comment so that closing sends a FIN, not a reset.
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		if strings.HasPrefix(line, ": stream opened") {
+			break
+		}
+	}
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream was not done after the client closed the connection")
+	}
+}
+
+func TestResetCancelsRequestContext(t *testing.T) {
+	cancelled := make(chan struct{})
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		select {
+		case <-req.Context().Done():
+			close(cancelled)
+		case <-time.After(2 * time.Second):
+		}
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	conn.(*net.TCPConn).SetLinger(0)
+	conn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("request context was not cancelled after the connection was reset")
+	}
+}
+
+func TestMultipartTempFilesRemovedAfterHandler(t *testing.T) {
+	paths := make(chan string, 1)
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		if err := req.ParseMultipartForm(10); err != nil {
+			return
+		}
+		f, err := req.MultipartForm.File["file"][0].Open()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		if disk, ok := f.(*os.File); ok {
+			paths <- disk.Name()
+		}
+	})
+
+	body := "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"big.txt\"\r\n\r\n" +
+		strings.Repeat("x", 100) + "\r\n--b--\r\n"
+	_, err := fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nHost: localhost\r\n"+
+		"Content-Type: multipart/form-data; boundary=b\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	require.NoError(t, err)
+	io.ReadAll(conn)
+
+	path := <-paths
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTooMuchDataAfterRequest(t *testing.T) {
+	errs := make(chan error, 1)
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(2 * time.Second):
+			errs <- errors.New("request context was not cancelled")
+			return
+		}
+		_, _, err := w.Hijack()
+		errs <- err
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = conn.Write(bytes.Repeat([]byte("x"), 2*maxWatchedBytes))
+	require.NoError(t, err)
+	assert.ErrorIs(t, <-errs, ErrTooMuchBuffered)
+}
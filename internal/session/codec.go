@@ -0,0 +1,128 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const maxCookieSize = 4096
+
+var (
+	ErrInvalidSignature = errors.New("session: invalid signature")
+	ErrExpired          = errors.New("session: value expired")
+	ErrTooLarge         = errors.New("session: encoded value too large")
+)
+
+type Key struct {
+	Hash  []byte
+	Block []byte
+}
+
+type keyPair struct {
+	hash []byte
+	aead cipher.AEAD
+}
+
+type Codec struct {
+	keys []keyPair
+	now  func() time.Time
+}
+
+func NewCodec(keys ...Key) (*Codec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: at least one key is required")
+	}
+
+	codec := &Codec{now: time.Now}
+	for i, key := range keys {
+		if len(key.Hash) < 32 {
+			return nil, fmt.Errorf("session: hash key %d must be at least 32 bytes", i)
+		}
+		kp := keyPair{hash: key.Hash}
+		if key.Block != nil {
+			block, err := aes.NewCipher(key.Block)
+			if err != nil {
+				return nil, fmt.Errorf("session: block key %d: %s", i, err.Error())
+			}
+			kp.aead, err = cipher.NewGCM(block)
+			if err != nil {
+				return nil, fmt.Errorf("session: block key %d: %s", i, err.Error())
+			}
+		}
+		codec.keys = append(codec.keys, kp)
+	}
+	return codec, nil
+}
+
+func (c *Codec) Encode(name string, value []byte) (string, error) {
+	kp := c.keys[0]
+
+	payload := binary.BigEndian.AppendUint64(nil, uint64(c.now().Unix()))
+	payload = append(payload, value...)
+	if kp.aead != nil {
+		nonce := make([]byte, kp.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = kp.aead.Seal(nonce, nonce, payload, []byte(name))
+	}
+
+	signed := append(payload, sign(kp.hash, name, payload)...)
+	encoded := base64.RawURLEncoding.EncodeToString(signed)
+	if len(encoded) > maxCookieSize {
+		return "", ErrTooLarge
+	}
+	return encoded, nil
+}
+
+func (c *Codec) Decode(name, encoded string, maxAge time.Duration) ([]byte, error) {
+	signed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(signed) < sha256.Size {
+		return nil, ErrInvalidSignature
+	}
+	payload, mac := signed[:len(signed)-sha256.Size], signed[len(signed)-sha256.Size:]
+
+	for _, kp := range c.keys {
+		if !hmac.Equal(mac, sign(kp.hash, name, payload)) {
+			continue
+		}
+
+		plain := payload
+		if kp.aead != nil {
+			nonceSize := kp.aead.NonceSize()
+			if len(payload) < nonceSize {
+				return nil, ErrInvalidSignature
+			}
+			plain, err = kp.aead.Open(nil, payload[:nonceSize], payload[nonceSize:], []byte(name))
+			if err != nil {
+				return nil, ErrInvalidSignature
+			}
+		}
+		if len(plain) < 8 {
+			return nil, ErrInvalidSignature
+		}
+
+		issued := time.Unix(int64(binary.BigEndian.Uint64(plain[:8])), 0)
+		if maxAge > 0 && c.now().Sub(issued) > maxAge {
+			return nil, ErrExpired
+		}
+		return plain[8:], nil
+	}
+	return nil, ErrInvalidSignature
+}
+
+func sign(key []byte, name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
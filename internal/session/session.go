@@ -0,0 +1,199 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/cookie"
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+const defaultCookieName = "session"
+
+type contextKey struct{}
+
+type Options struct {
+	CookieName string
+	Path       string
+	Domain     string
+	MaxAge     time.Duration
+	Secure     bool
+	HttpOnly   bool
+	SameSite   cookie.SameSite
+}
+
+type Session struct {
+	id        string
+	oldID     string
+	values    map[string]string
+	isNew     bool
+	modified  bool
+	destroyed bool
+}
+
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+func (s *Session) Get(key string) (string, bool) {
+	val, ok := s.values[key]
+	return val, ok
+}
+
+func (s *Session) Set(key, val string) {
+	s.values[key] = val
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.values, key)
+	s.modified = true
+}
+
+func (s *Session) Destroy() {
+	s.values = make(map[string]string)
+	s.destroyed = true
+}
+
+func (s *Session) RenewID() {
+	if s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = rand.Text()
+	s.modified = true
+}
+
+type Manager struct {
+	codec *Codec
+	store Store
+	opts  Options
+}
+
+func NewManager(codec *Codec, store Store, opts Options) *Manager {
+	if opts.CookieName == "" {
+		opts.CookieName = defaultCookieName
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	return &Manager{
+		codec: codec,
+		store: store,
+		opts:  opts,
+	}
+}
+
+func FromRequest(r *request.Request) *Session {
+	sess, _ := r.Context().Value(contextKey{}).(*Session)
+	return sess
+}
+
+func (m *Manager) Handle(next server.Handler) server.Handler {
+	return func(w *response.Writer, r *request.Request) {
+		sess := m.load(r)
+		w.OnWriteHeaders(func(response.StatusCode, headers.Headers) {
+			if err := m.save(w, sess); err != nil {
+				log.Printf("saving session: %s", err.Error())
+			}
+		})
+		next(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, sess)))
+	}
+}
+
+func (m *Manager) load(r *request.Request) *Session {
+	fresh := &Session{
+		id:     rand.Text(),
+		values: make(map[string]string),
+		isNew:  true,
+	}
+
+	c, ok := r.Cookie(m.opts.CookieName)
+	if !ok {
+		return fresh
+	}
+	data, err := m.codec.Decode(m.opts.CookieName, c.Value, m.opts.MaxAge)
+	if err != nil {
+		return fresh
+	}
+
+	if m.store == nil {
+		values := make(map[string]string)
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fresh
+		}
+		return &Session{values: values}
+	}
+
+	id := string(data)
+	values, ok, err := m.store.Load(id)
+	if err != nil {
+		log.Printf("loading session: %s", err.Error())
+		return fresh
+	}
+	if !ok {
+		return fresh
+	}
+	return &Session{id: id, values: values}
+}
+
+func (m *Manager) save(w *response.Writer, sess *Session) error {
+	if sess.destroyed {
+		if m.store != nil && !sess.isNew {
+			if err := m.store.Delete(sess.id); err != nil {
+				return err
+			}
+		}
+		return w.SetCookie(m.cookie("", -1))
+	}
+	if !sess.modified {
+		return nil
+	}
+
+	var payload []byte
+	if m.store == nil {
+		data, err := json.Marshal(sess.values)
+		if err != nil {
+			return err
+		}
+		payload = data
+	} else {
+		if sess.oldID != "" {
+			if err := m.store.Delete(sess.oldID); err != nil {
+				return err
+			}
+		}
+		var expires time.Time
+		if m.opts.MaxAge > 0 {
+			expires = time.Now().Add(m.opts.MaxAge)
+		}
+		if err := m.store.Save(sess.id, sess.values, expires); err != nil {
+			return err
+		}
+		payload = []byte(sess.id)
+	}
+
+	encoded, err := m.codec.Encode(m.opts.CookieName, payload)
+	if err != nil {
+		return err
+	}
+	return w.SetCookie(m.cookie(encoded, int(m.opts.MaxAge/time.Second)))
+}
+
+func (m *Manager) cookie(value string, maxAge int) *cookie.Cookie {
+	return &cookie.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    value,
+		Path:     m.opts.Path,
+		Domain:   m.opts.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.opts.Secure,
+		HttpOnly: m.opts.HttpOnly,
+		SameSite: m.opts.SameSite,
+	}
+}
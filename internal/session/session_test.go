@@ -0,0 +1,196 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	hashKey1  = bytes.Repeat([]byte("a"), 32)
+	hashKey2  = bytes.Repeat([]byte("b"), 32)
+	blockKey1 = bytes.Repeat([]byte("c"), 32)
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec, err := NewCodec(Key{Hash: hashKey1})
+	require.NoError(t, err)
+
+	encoded, err := codec.Encode("session", []byte("user=alvaro"))
+	require.NoError(t, err)
+	decoded, err := codec.Decode("session", encoded, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "user=alvaro", string(decoded))
+	assert.Contains(t, string(mustDecodeBase64(t, encoded)), "user=alvaro")
+
+	_, err = codec.Decode("other", encoded, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	tampered := []byte(encoded)
+	tampered[3] ^= 1
+	_, err = codec.Decode("session", string(tampered), time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestCodecEncryption(t *testing.T) {
+	codec, err := NewCodec(Key{Hash: hashKey1, Block: blockKey1})
+	require.NoError(t, err)
+
+	encoded, err := codec.Encode("session", []byte("secret-value"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(mustDecodeBase64(t, encoded)), "secret-value")
+
+	decoded, err := codec.Decode("session", encoded, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "secret-value", string(decoded))
+}
+
+func TestCodecKeyRotation(t *testing.T) {
+	oldCodec, err := NewCodec(Key{Hash: hashKey1})
+	require.NoError(t, err)
+	encoded, err := oldCodec.Encode("session", []byte("v"))
+	require.NoError(t, err)
+
+	rotated, err := NewCodec(Key{Hash: hashKey2}, Key{Hash: hashKey1})
+	require.NoError(t, err)
+	decoded, err := rotated.Decode("session", encoded, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "v", string(decoded))
+
+	newOnly, err := NewCodec(Key{Hash: hashKey2})
+	require.NoError(t, err)
+	_, err = newOnly.Decode("session", encoded, 0)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestCodecExpiry(t *testing.T) {
+	codec, err := NewCodec(Key{Hash: hashKey1})
+	require.NoError(t, err)
+	encoded, err := codec.Encode("session", []byte("v"))
+	require.NoError(t, err)
+
+	codec.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = codec.Decode("session", encoded, time.Hour)
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Save("a", map[string]string{"k": "v"}, now.Add(time.Minute)))
+	require.NoError(t, store.Save("b", map[string]string{"k": "v"}, now.Add(time.Hour)))
+	values, ok, err := store.Load("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "v", values["k"])
+
+	now = now.Add(2 * time.Minute)
+	_, ok, err = store.Load("a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, 1, store.DeleteExpired())
+}
+
+func counterHandler(w *response.Writer, r *request.Request) {
+	sess := FromRequest(r)
+	count, _ := sess.Get("count")
+	count += "x"
+	sess.Set("count", count)
+
+	w.WriteStatusLine(response.OkStatus)
+	w.WriteHeaders(response.GetDefaultHeaders(len(count)))
+	w.WriteBody([]byte(count))
+}
+
+func doRequest(t *testing.T, handler func(*response.Writer, *request.Request), cookieHeader string) (string, string) {
+	t.Helper()
+	raw := "GET / HTTP/1.1\r\nHost: localhost:42069\r\n"
+	if cookieHeader != "" {
+		raw += "Cookie: " + cookieHeader + "\r\n"
+	}
+	rq, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	w := response.NewWriter(out)
+	handler(&w, rq)
+
+	res := out.String()
+	var setCookie string
+	for _, line := range strings.Split(res, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "Set-Cookie: "); ok {
+			setCookie = v
+		}
+	}
+	_, body, _ := strings.Cut(res, "\r\n\r\n")
+	return body, setCookie
+}
+
+func cookiePair(setCookie string) string {
+	pair, _, _ := strings.Cut(setCookie, ";")
+	return pair
+}
+
+func TestCookieSessionMiddleware(t *testing.T) {
+	codec, err := NewCodec(Key{Hash: hashKey1, Block: blockKey1})
+	require.NoError(t, err)
+	manager := NewManager(codec, nil, Options{HttpOnly: true, MaxAge: time.Hour})
+	handler := manager.Handle(counterHandler)
+
+	body, setCookie := doRequest(t, handler, "")
+	assert.Equal(t, "x", body)
+	assert.Contains(t, setCookie, "; Path=/; Max-Age=3600; HttpOnly")
+
+	body, _ = doRequest(t, handler, cookiePair(setCookie))
+	assert.Equal(t, "xx", body)
+
+	body, _ = doRequest(t, handler, "session=forged")
+	assert.Equal(t, "x", body)
+}
+
+func TestStoreSessionMiddleware(t *testing.T) {
+	codec, err := NewCodec(Key{Hash: hashKey1})
+	require.NoError(t, err)
+	store := NewMemoryStore()
+	manager := NewManager(codec, store, Options{CookieName: "sid"})
+	handler := manager.Handle(counterHandler)
+
+	body, setCookie := doRequest(t, handler, "")
+	assert.Equal(t, "x", body)
+	require.True(t, strings.HasPrefix(setCookie, "sid="))
+	assert.NotContains(t, setCookie, "count")
+
+	body, _ = doRequest(t, handler, cookiePair(setCookie))
+	assert.Equal(t, "xx", body)
+
+	logout := manager.Handle(func(w *response.Writer, r *request.Request) {
+		FromRequest(r).Destroy()
+		w.WriteStatusLine(response.OkStatus)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		w.WriteBody(nil)
+	})
+	_, expired := doRequest(t, logout, cookiePair(setCookie))
+	assert.Contains(t, expired, "Max-Age=0")
+	assert.Empty(t, store.sessions)
+
+	body, _ = doRequest(t, handler, cookiePair(setCookie))
+	assert.Equal(t, "x", body)
+}
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return data
+}
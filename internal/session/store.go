@@ -0,0 +1,83 @@
+package session
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+type Store interface {
+	Load(id string) (map[string]string, bool, error)
+	Save(id string, values map[string]string, expires time.Time) error
+	Delete(id string) error
+}
+
+type memoryEntry struct {
+	values  map[string]string
+	expires time.Time
+}
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	now      func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]memoryEntry),
+		now:      time.Now,
+	}
+}
+
+func (ms *MemoryStore) Load(id string) (map[string]string, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.sessions[id]
+	if !ok {
+		return nil, false, nil
+	}
+	if ms.expired(entry) {
+		delete(ms.sessions, id)
+		return nil, false, nil
+	}
+	return maps.Clone(entry.values), true, nil
+}
+
+func (ms *MemoryStore) Save(id string, values map[string]string, expires time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.sessions[id] = memoryEntry{
+		values:  maps.Clone(values),
+		expires: expires,
+	}
+	return nil
+}
+
+func (ms *MemoryStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.sessions, id)
+	return nil
+}
+
+func (ms *MemoryStore) DeleteExpired() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	removed := 0
+	for id, entry := range ms.sessions {
+		if ms.expired(entry) {
+			delete(ms.sessions, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (ms *MemoryStore) expired(entry memoryEntry) bool {
+	return !entry.expires.IsZero() && !ms.now().Before(entry.expires)
+}
@@ -0,0 +1,177 @@
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+)
+
+var ErrClosed = errors.New("sse: stream closed")
+
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+type Stream struct {
+	w           *response.Writer
+	lastEventID string
+	mu          sync.Mutex
+	closed      bool
+	done        chan struct{}
+	stop        func()
+}
+
+func NewStream(w *response.Writer, r *request.Request) (*Stream, error) {
+	hdrs := response.GetDefaultHeaders(0)
+	hdrs.Remove("Content-Length")
+	hdrs.Set("Content-Type", "text/event-stream")
+	hdrs.Set("Cache-Control", "no-cache")
+	hdrs.Set("Transfer-Encoding", "chunked")
+
+	if err := w.WriteStatusLine(response.OkStatus); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(hdrs); err != nil {
+		return nil, err
+	}
+
+	lastEventID, _ := r.Headers.Get("Last-Event-ID")
+	s := &Stream{
+		w:           w,
+		lastEventID: lastEventID,
+		done:        make(chan struct{}),
+	}
+	s.stop = sync.OnceFunc(func() { close(s.done) })
+
+	ctx := r.Context()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.markClosed()
+		case <-s.done:
+		}
+	}()
+
+	if err := s.write([]byte(": stream opened\n\n")); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Stream) LastEventID() string {
+	return s.lastEventID
+}
+
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Stream) Send(ev Event) error {
+	if strings.ContainsAny(ev.ID, "\r\n\x00") {
+		return fmt.Errorf("sse: invalid event id %q", ev.ID)
+	}
+	if strings.ContainsAny(ev.Event, "\r\n") {
+		return fmt.Errorf("sse: invalid event name %q", ev.Event)
+	}
+
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + ev.Event + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range splitLines(ev.Data) {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write([]byte(b.String()))
+}
+
+func (s *Stream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range splitLines(text) {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write([]byte(b.String()))
+}
+
+func (s *Stream) Heartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if err := s.Comment("heartbeat"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.stop()
+	if _, err := s.w.WriteChunkedBodyDone(); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *Stream) write(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if _, err := s.w.WriteChunkedBody(p); err != nil {
+		s.closeLocked()
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.closeLocked()
+		return fmt.Errorf("sse: client disconnected: %w", err)
+	}
+	return nil
+}
+
+func (s *Stream) markClosed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *Stream) closeLocked() {
+	s.closed = true
+	s.stop()
+}
+
+func splitLines(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	return strings.Split(data, "\n")
+}
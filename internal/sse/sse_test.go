@@ -0,0 +1,113 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flushBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	flushes int
+	failing bool
+}
+
+func (fb *flushBuffer) Write(p []byte) (int, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	return fb.buf.Write(p)
+}
+
+func (fb *flushBuffer) Flush() error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.flushes++
+	if fb.failing {
+		return errors.New("broken pipe")
+	}
+	return nil
+}
+
+func (fb *flushBuffer) String() string {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	return fb.buf.String()
+}
+
+func newStream(t *testing.T, reqHeaders string) (*Stream, *flushBuffer, context.CancelFunc) {
+	t.Helper()
+	r, err := request.RequestFromReader(strings.NewReader("GET /events HTTP/1.1\r\nHost: localhost:42069\r\n" + reqHeaders + "\r\n"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	out := &flushBuffer{}
+	w := response.NewWriter(out)
+	s, err := NewStream(&w, r.WithContext(ctx))
+	require.NoError(t, err)
+	return s, out, cancel
+}
+
+func TestStreamHeadersAndEvents(t *testing.T) {
+	s, out, cancel := newStream(t, "Last-Event-ID: 41\r\n")
+	defer cancel()
+	assert.Equal(t, "41", s.LastEventID())
+
+	require.NoError(t, s.Send(Event{ID: "42", Event: "update", Data: "line one\nline two\r\nline three", Retry: 3 * time.Second}))
+	require.NoError(t, s.Close())
+
+	res := out.String()
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "Content-Type: text/event-stream\r\n")
+	assert.Contains(t, res, "Cache-Control: no-cache\r\n")
+	assert.NotContains(t, res, "Content-Length")
+	assert.Contains(t, res, "id: 42\nevent: update\nretry: 3000\ndata: line one\ndata: line two\ndata: line three\n\n")
+	assert.True(t, strings.HasSuffix(res, "0\r\n\r\n"))
+	assert.GreaterOrEqual(t, out.flushes, 3)
+}
+
+func TestStreamRejectsInvalidFields(t *testing.T) {
+	s, _, cancel := newStream(t, "")
+	defer cancel()
+	assert.Error(t, s.Send(Event{ID: "a\nb", Data: "x"}))
+	assert.Error(t, s.Send(Event{Event: "a\rb", Data: "x"}))
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	s, out, cancel := newStream(t, "")
+	defer cancel()
+	s.Heartbeat(5 * time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), ": heartbeat\n\n")
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.Close())
+}
+
+func TestStreamNoticesDisconnect(t *testing.T) {
+	s, _, cancel := newStream(t, "")
+	cancel()
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream did not notice context cancellation")
+	}
+	assert.ErrorIs(t, s.Send(Event{Data: "late"}), ErrClosed)
+
+	s, out, cancel := newStream(t, "")
+	defer cancel()
+	out.mu.Lock()
+	out.failing = true
+	out.mu.Unlock()
+	assert.Error(t, s.Send(Event{Data: "lost"}))
+	<-s.Done()
+}
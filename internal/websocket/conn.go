@@ -0,0 +1,431 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type MessageType int
+
+const (
+	continuationFrame MessageType = 0x0
+	TextMessage       MessageType = 0x1
+	BinaryMessage     MessageType = 0x2
+	closeFrame        MessageType = 0x8
+	pingFrame         MessageType = 0x9
+	pongFrame         MessageType = 0xA
+)
+
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	CloseMessageTooBig   = 1009
+)
+
+const (
+	maxControlPayload     = 125
+	defaultMaxMessageSize = 1 << 20
+	closeTimeout          = 5 * time.Second
+)
+
+var ErrClosed = errors.New("websocket: connection closed")
+
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Reason)
+}
+
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  MessageType
+	payload []byte
+}
+
+type Conn struct {
+	conn           net.Conn
+	br             *bufio.Reader
+	isServer       bool
+	subprotocol    string
+	compress       bool
+	MaxMessageSize int64
+	FragmentSize   int
+	OnPing         func(data []byte)
+	OnPong         func(data []byte)
+
+	writeMu   sync.Mutex
+	closeSent bool
+	closed    bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool, subprotocol string, compress bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{
+		conn:           conn,
+		br:             br,
+		isServer:       isServer,
+		subprotocol:    subprotocol,
+		compress:       compress,
+		MaxMessageSize: defaultMaxMessageSize,
+	}
+}
+
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+func (c *Conn) Compressed() bool {
+	return c.compress
+}
+
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		msgType    MessageType
+		msg        []byte
+		compressed bool
+		inMessage  bool
+	)
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case pingFrame:
+			if c.OnPing != nil {
+				c.OnPing(f.payload)
+			}
+			if err := c.writeFrame(pongFrame, f.payload, true, false); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongFrame:
+			if c.OnPong != nil {
+				c.OnPong(f.payload)
+			}
+			continue
+		case closeFrame:
+			return 0, nil, c.handleClose(f.payload)
+		case TextMessage, BinaryMessage:
+			if inMessage {
+				return 0, nil, c.fail(CloseProtocolError, "new message before previous one finished")
+			}
+			inMessage = true
+			msgType = f.opcode
+			compressed = f.rsv1
+		case continuationFrame:
+			if !inMessage {
+				return 0, nil, c.fail(CloseProtocolError, "continuation frame without a message")
+			}
+			if f.rsv1 {
+				return 0, nil, c.fail(CloseProtocolError, "rsv1 set on continuation frame")
+			}
+		}
+
+		if int64(len(msg)+len(f.payload)) > c.MaxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		msg = append(msg, f.payload...)
+		if !f.fin {
+			continue
+		}
+
+		if compressed {
+			msg, err = inflate(msg, c.MaxMessageSize)
+			if err != nil {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid compressed message")
+			}
+		}
+		if msgType == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid utf-8 in text message")
+		}
+		return msgType, msg, nil
+	}
+}
+
+func (c *Conn) WriteMessage(msgType MessageType, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", msgType)
+	}
+
+	compressed := false
+	if c.compress {
+		deflated, err := deflate(data)
+		if err != nil {
+			return err
+		}
+		data = deflated
+		compressed = true
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.FragmentSize <= 0 || len(data) <= c.FragmentSize {
+		return c.writeFrameLocked(msgType, data, true, compressed)
+	}
+
+	opcode := msgType
+	for len(data) > 0 {
+		n := min(c.FragmentSize, len(data))
+		fin := n == len(data)
+		if err := c.writeFrameLocked(opcode, data[:n], fin, compressed && opcode != continuationFrame); err != nil {
+			return err
+		}
+		data = data[n:]
+		opcode = continuationFrame
+	}
+	return nil
+}
+
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: ping payload too large")
+	}
+	return c.writeFrame(pingFrame, data, true, false)
+}
+
+func (c *Conn) Close(code int, reason string) error {
+	c.writeMu.Lock()
+	closed := c.closed
+	c.writeMu.Unlock()
+	if closed {
+		return nil
+	}
+
+	if err := c.sendClose(code, reason); err != nil {
+		c.conn.Close()
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	for {
+		_, _, err := c.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	return c.conn.Close()
+}
+
+func (c *Conn) handleClose(payload []byte) error {
+	code, reason := CloseNoStatus, ""
+	switch {
+	case len(payload) == 1:
+		c.fail(CloseProtocolError, "invalid close payload")
+		return &CloseError{Code: CloseProtocolError}
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		reason = string(payload[2:])
+		if !validCloseCode(code) || !utf8.ValidString(reason) {
+			c.fail(CloseProtocolError, "invalid close payload")
+			return &CloseError{Code: CloseProtocolError}
+		}
+	}
+
+	c.writeMu.Lock()
+	initiatedByUs := c.closeSent
+	c.writeMu.Unlock()
+
+	replyCode := code
+	if code == CloseNoStatus {
+		replyCode = CloseNormal
+	}
+	c.sendClose(replyCode, "")
+	c.writeMu.Lock()
+	c.closed = true
+	c.writeMu.Unlock()
+	if !initiatedByUs {
+		c.conn.Close()
+	}
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (c *Conn) fail(code int, reason string) error {
+	c.sendClose(code, reason)
+	c.writeMu.Lock()
+	c.closed = true
+	c.writeMu.Unlock()
+	c.conn.Close()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (c *Conn) sendClose(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return nil
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	err := c.writeFrameLocked(closeFrame, payload, true, false)
+	c.closeSent = true
+	return err
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{
+		fin:    header[0]&0x80 != 0,
+		rsv1:   header[0]&0x40 != 0,
+		opcode: MessageType(header[0] & 0x0F),
+	}
+	if header[0]&0x30 != 0 || (f.rsv1 && !c.compress) {
+		return frame{}, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	switch f.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case closeFrame, pingFrame, pongFrame:
+		if !f.fin || f.rsv1 {
+			return frame{}, c.fail(CloseProtocolError, "invalid control frame")
+		}
+	default:
+		return frame{}, c.fail(CloseProtocolError, "unknown opcode")
+	}
+
+	masked := header[1]&0x80 != 0
+	if masked != c.isServer {
+		return frame{}, c.fail(CloseProtocolError, "invalid frame masking")
+	}
+
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return frame{}, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	}
+	if f.opcode >= closeFrame && length > maxControlPayload {
+		return frame{}, c.fail(CloseProtocolError, "control frame too large")
+	}
+	if length > c.MaxMessageSize {
+		return frame{}, c.fail(CloseMessageTooBig, "frame too big")
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, maskKey[:]); err != nil {
+			return frame{}, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+	if masked {
+		maskBytes(maskKey, f.payload)
+	}
+	return f, nil
+}
+
+func (c *Conn) writeFrame(opcode MessageType, payload []byte, fin, rsv1 bool) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeFrameLocked(opcode, payload, fin, rsv1)
+}
+
+func (c *Conn) writeFrameLocked(opcode MessageType, payload []byte, fin, rsv1 bool) error {
+	if c.closeSent || c.closed {
+		return ErrClosed
+	}
+
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	if rsv1 {
+		b0 |= 0x40
+	}
+	buf := []byte{b0}
+
+	var maskBit byte
+	if !c.isServer {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		buf = append(buf, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(len(payload)))
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		buf = append(buf, maskKey[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(maskKey, buf[start:])
+	}
+
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"strings"
+)
+
+const deflateExtension = "permessage-deflate"
+
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+func deflate(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fw, err := flate.NewWriter(buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail), nil
+}
+
+func inflate(data []byte, maxSize int64) ([]byte, error) {
+	src := io.MultiReader(
+		bytes.NewReader(data),
+		bytes.NewReader(deflateTail),
+		bytes.NewReader([]byte{0x01, 0x00, 0x00, 0xff, 0xff}),
+	)
+	fr := flate.NewReader(src)
+	defer fr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(fr, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > maxSize {
+		return nil, errors.New("websocket: decompressed message too big")
+	}
+	return out, nil
+}
+
+func negotiateDeflate(offers string) (string, bool) {
+	for _, offer := range strings.Split(offers, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != deflateExtension {
+			continue
+		}
+
+		response := deflateExtension + "; client_no_context_takeover"
+		acceptable := true
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch key {
+			case "server_no_context_takeover":
+				response += "; server_no_context_takeover"
+			case "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				if strings.Trim(val, `"`) != "15" {
+					acceptable = false
+				}
+			default:
+				acceptable = false
+			}
+		}
+		if acceptable {
+			return response, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,208 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/alerone/httpfromtcp/internal/headers"
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+)
+
+const (
+	acceptGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	supportedVersion = "13"
+)
+
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+type Handler func(conn *Conn, req *request.Request)
+
+type Upgrader struct {
+	Subprotocols      []string
+	EnableCompression bool
+	CheckOrigin       func(r *request.Request) bool
+}
+
+func IsUpgradeRequest(r *request.Request) bool {
+	upgrade, _ := r.Headers.Get("Upgrade")
+	connection, _ := r.Headers.Get("Connection")
+	return hasToken(upgrade, "websocket") && hasToken(connection, "upgrade")
+}
+
+func Handle(u *Upgrader, h Handler) server.Handler {
+	return func(w *response.Writer, r *request.Request) {
+		conn, err := u.Upgrade(w, r)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		h(conn, r)
+	}
+}
+
+func (u *Upgrader) Upgrade(w *response.Writer, r *request.Request) (*Conn, error) {
+	if r.RequestLine.Method != "GET" || !IsUpgradeRequest(r) {
+		return nil, handshakeError(w, response.BadRequestStatus, "not a websocket upgrade request")
+	}
+	if version, _ := r.Headers.Get("Sec-WebSocket-Version"); version != supportedVersion {
+		msg := "unsupported websocket version"
+		hdrs := response.GetDefaultHeaders(len(msg))
+		hdrs.Set("Sec-WebSocket-Version", supportedVersion)
+		w.WriteStatusLine(response.UpgradeRequiredStatus)
+		w.WriteHeaders(hdrs)
+		w.WriteBody([]byte(msg))
+		return nil, fmt.Errorf("%w: %s", ErrBadHandshake, msg)
+	}
+	key, _ := r.Headers.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, handshakeError(w, response.BadRequestStatus, "invalid Sec-WebSocket-Key")
+	}
+	if u.CheckOrigin != nil && !u.CheckOrigin(r) {
+		return nil, handshakeError(w, response.ForbiddenStatus, "origin not allowed")
+	}
+
+	hdrs := headers.NewHeaders()
+	hdrs.Set("Upgrade", "websocket")
+	hdrs.Set("Connection", "Upgrade")
+	hdrs.Set("Sec-WebSocket-Accept", acceptKey(key))
+
+	subprotocol := u.selectSubprotocol(r)
+	if subprotocol != "" {
+		hdrs.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	compress := false
+	if u.EnableCompression {
+		offers, _ := r.Headers.Get("Sec-WebSocket-Extensions")
+		if ext, ok := negotiateDeflate(offers); ok {
+			hdrs.Set("Sec-WebSocket-Extensions", ext)
+			compress = true
+		}
+	}
+
+	w.WriteStatusLine(response.SwitchingProtocolsStatus)
+	w.WriteHeaders(hdrs)
+	if err := w.WriteEmptyBody(); err != nil {
+		return nil, err
+	}
+	conn, buffered, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), conn))
+	return newConn(conn, br, true, subprotocol, compress), nil
+}
+
+func (u *Upgrader) selectSubprotocol(r *request.Request) string {
+	offered, ok := r.Headers.Get("Sec-WebSocket-Protocol")
+	if !ok {
+		return ""
+	}
+	for _, proto := range strings.Split(offered, ",") {
+		proto = strings.TrimSpace(proto)
+		if slices.Contains(u.Subprotocols, proto) {
+			return proto
+		}
+	}
+	return ""
+}
+
+type DialOptions struct {
+	Host         string
+	Subprotocols []string
+	Compression  bool
+}
+
+func Client(conn net.Conn, target string, opts DialOptions) (*Conn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "GET %s HTTP/1.1\r\n", target)
+	fmt.Fprintf(&req, "Host: %s\r\n", opts.Host)
+	req.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	fmt.Fprintf(&req, "Sec-WebSocket-Key: %s\r\n", key)
+	fmt.Fprintf(&req, "Sec-WebSocket-Version: %s\r\n", supportedVersion)
+	if len(opts.Subprotocols) > 0 {
+		fmt.Fprintf(&req, "Sec-WebSocket-Protocol: %s\r\n", strings.Join(opts.Subprotocols, ", "))
+	}
+	if opts.Compression {
+		fmt.Fprintf(&req, "Sec-WebSocket-Extensions: %s; client_no_context_takeover; server_no_context_takeover\r\n", deflateExtension)
+	}
+	req.WriteString("\r\n")
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	statusLine, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(statusLine, "HTTP/1.1 101") {
+		return nil, fmt.Errorf("%w: unexpected status %q", ErrBadHandshake, strings.TrimSpace(statusLine))
+	}
+
+	hdrs := headers.NewHeaders()
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		_, done, err := hdrs.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBadHandshake, err.Error())
+		}
+		if done {
+			break
+		}
+	}
+
+	if accept, _ := hdrs.Get("Sec-WebSocket-Accept"); accept != acceptKey(key) {
+		return nil, fmt.Errorf("%w: invalid Sec-WebSocket-Accept", ErrBadHandshake)
+	}
+	subprotocol, _ := hdrs.Get("Sec-WebSocket-Protocol")
+	if subprotocol != "" && !slices.Contains(opts.Subprotocols, subprotocol) {
+		return nil, fmt.Errorf("%w: server selected unknown subprotocol %q", ErrBadHandshake, subprotocol)
+	}
+	ext, _ := hdrs.Get("Sec-WebSocket-Extensions")
+	compress := opts.Compression && strings.HasPrefix(strings.TrimSpace(ext), deflateExtension)
+
+	return newConn(conn, br, false, subprotocol, compress), nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+acceptGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func handshakeError(w *response.Writer, statusCode response.StatusCode, msg string) error {
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(response.GetDefaultHeaders(len(msg)))
+	w.WriteBody([]byte(msg))
+	return fmt.Errorf("%w: %s", ErrBadHandshake, msg)
+}
+
+func hasToken(header, token string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
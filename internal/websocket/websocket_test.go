@@ -0,0 +1,194 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerone/httpfromtcp/internal/request"
+	"github.com/alerone/httpfromtcp/internal/response"
+	"github.com/alerone/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, upgrader *Upgrader, handler Handler) string {
+	t.Helper()
+	srv, err := server.Serve(0, Handle(upgrader, handler))
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return fmt.Sprintf("127.0.0.1:%d", srv.Addr().(*net.TCPAddr).Port)
+}
+
+func dial(t *testing.T, addr string, opts DialOptions) *Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	opts.Host = addr
+	ws, err := Client(conn, "/ws", opts)
+	require.NoError(t, err)
+	return ws
+}
+
+func echoHandler(conn *Conn, req *request.Request) {
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(msgType, data); err != nil {
+			return
+		}
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestEchoAndSubprotocol(t *testing.T) {
+	addr := startServer(t, &Upgrader{Subprotocols: []string{"chat.v2", "chat.v1"}}, echoHandler)
+	ws := dial(t, addr, DialOptions{Subprotocols: []string{"chat.v1", "chat.v2"}})
+	assert.Equal(t, "chat.v1", ws.Subprotocol())
+
+	require.NoError(t, ws.WriteMessage(TextMessage, []byte("hello")))
+	msgType, data, err := ws.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, msgType)
+	assert.Equal(t, "hello", string(data))
+
+	payload := bytes.Repeat([]byte{0, 1, 2, 255}, 20000)
+	require.NoError(t, ws.WriteMessage(BinaryMessage, payload))
+	msgType, data, err = ws.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, BinaryMessage, msgType)
+	assert.Equal(t, payload, data)
+}
+
+func TestFragmentationAndPing(t *testing.T) {
+	addr := startServer(t, &Upgrader{}, echoHandler)
+	ws := dial(t, addr, DialOptions{})
+	ws.FragmentSize = 3
+
+	pongs := make(chan string, 1)
+	ws.OnPong = func(data []byte) { pongs <- string(data) }
+	require.NoError(t, ws.Ping([]byte("are you there?")))
+
+	require.NoError(t, ws.WriteMessage(TextMessage, []byte("fragmented message")))
+	_, data, err := ws.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "fragmented message", string(data))
+	assert.Equal(t, "are you there?", <-pongs)
+}
+
+func TestPerMessageDeflate(t *testing.T) {
+	addr := startServer(t, &Upgrader{EnableCompression: true}, echoHandler)
+	ws := dial(t, addr, DialOptions{Compression: true})
+	require.True(t, ws.Compressed())
+
+	msg := strings.Repeat("compress me please ", 500)
+	for range 3 {
+		require.NoError(t, ws.WriteMessage(TextMessage, []byte(msg)))
+		_, data, err := ws.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(data))
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	closed := make(chan error, 1)
+	addr := startServer(t, &Upgrader{}, func(conn *Conn, req *request.Request) {
+		_, _, err := conn.ReadMessage()
+		closed <- err
+	})
+	ws := dial(t, addr, DialOptions{})
+	require.NoError(t, ws.Close(CloseNormal, "bye"))
+
+	var closeErr *CloseError
+	require.ErrorAs(t, <-closed, &closeErr)
+	assert.Equal(t, CloseNormal, closeErr.Code)
+	assert.Equal(t, "bye", closeErr.Reason)
+	assert.ErrorIs(t, ws.WriteMessage(TextMessage, []byte("late")), ErrClosed)
+}
+
+func TestServerRejectsUnmaskedFrames(t *testing.T) {
+	closed := make(chan error, 1)
+	addr := startServer(t, &Upgrader{}, func(conn *Conn, req *request.Request) {
+		_, _, err := conn.ReadMessage()
+		closed <- err
+	})
+	ws := dial(t, addr, DialOptions{})
+	ws.isServer = true
+	require.NoError(t, ws.WriteMessage(TextMessage, []byte("unmasked")))
+
+	var closeErr *CloseError
+	require.ErrorAs(t, <-closed, &closeErr)
+	assert.Equal(t, CloseProtocolError, closeErr.Code)
+}
+
+func TestRejectedHandshakes(t *testing.T) {
+	cases := []struct {
+		headers string
+		status  string
+	}{
+		{"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 8\r\n", "HTTP/1.1 426 Upgrade Required\r\n"},
+		{"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: short\r\nSec-WebSocket-Version: 13\r\n", "HTTP/1.1 400 Bad Request\r\n"},
+		{"Connection: keep-alive\r\n", "HTTP/1.1 400 Bad Request\r\n"},
+	}
+	for _, tc := range cases {
+		rq, err := request.RequestFromReader(strings.NewReader("GET /ws HTTP/1.1\r\nHost: localhost\r\n" + tc.headers + "\r\n"))
+		require.NoError(t, err)
+		out := new(bytes.Buffer)
+		w := response.NewWriter(out)
+		_, err = (&Upgrader{}).Upgrade(&w, rq)
+		assert.True(t, errors.Is(err, ErrBadHandshake))
+		assert.True(t, strings.HasPrefix(out.String(), tc.status), out.String())
+	}
+}
+
+func TestNegotiateDeflate(t *testing.T) {
+	ext, ok := negotiateDeflate("permessage-deflate; client_max_window_bits")
+	require.True(t, ok)
+	assert.Equal(t, "permessage-deflate; client_no_context_takeover", ext)
+
+	_, ok = negotiateDeflate("permessage-deflate; server_max_window_bits=10")
+	assert.False(t, ok)
+
+	ext, ok = negotiateDeflate("permessage-deflate; server_max_window_bits=10, permessage-deflate; server_no_context_takeover")
+	require.True(t, ok)
+	assert.Equal(t, "permessage-deflate; client_no_context_takeover; server_no_context_takeover", ext)
+}
+
+func TestFrameSentWithHandshake(t *testing.T) {
+	addr := startServer(t, &Upgrader{}, echoHandler)
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x81, 0x80 | 5}, mask...)
+	for i, b := range []byte("early") {
+		frame = append(frame, b^mask[i%4])
+	}
+	handshake := "GET /ws HTTP/1.1\r\nHost: " + addr + "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	_, err = conn.Write(append([]byte(handshake), frame...))
+	require.NoError(t, err)
+
+	var got []byte
+	buf := make([]byte, 512)
+	for !bytes.HasSuffix(got, []byte("\x81\x05early")) {
+		n, err := conn.Read(buf)
+		require.NoError(t, err, "frame sent with the handshake was lost: %q", got)
+		got = append(got, buf[:n]...)
+	}
+	assert.True(t, strings.HasPrefix(string(got), "HTTP/1.1 101 Switching Protocols\r\n"))
+}